@@ -0,0 +1,282 @@
+package chip8
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AssemblyError is returned by Assemble for a line it can't assemble.
+type AssemblyError struct {
+	// Line is the line number, counting from 1.
+	Line int
+	Err  error
+}
+
+func (e *AssemblyError) Error() string {
+	return fmt.Sprintf("chip8: line %d: %s", e.Line, e.Err)
+}
+
+func (e *AssemblyError) Unwrap() error {
+	return e.Err
+}
+
+// errNoMatch is returned by assembleSpec when the operands don't fit the
+// instruction's syntax at all, so another form of it should be tried.
+var errNoMatch = errors.New("operands don't match")
+
+// statement is a line of assembly with its label and comment removed.
+type statement struct {
+	line     int
+	mnemonic string
+	operands []string
+}
+
+// Assemble assembles CHIP-8 assembly into a program to be loaded at 0x200.
+// It takes the syntax Disassemble produces, one instruction per line, e.g.
+// "DRW V0, V1, 5", with mnemonics and registers in any case. Numbers are
+// decimal, or hex with 0x. Besides the instructions, it understands:
+//
+//   - comments, from ';' to the end of the line
+//   - labels, "name:" at the start of a line, which can be used for
+//     addresses, e.g. "JP name"
+//   - "DB b, ...", which places bytes, e.g. for sprites
+//   - "DW w", which places a 16-bit word
+//
+// Only the built-in opcodes can be assembled, not those added by options or
+// RegisterOpcode. Errors are AssemblyErrors, giving the line.
+func Assemble(src string) ([]byte, error) {
+	var statements []statement
+	labels := map[string]uint16{}
+	addr := 0x200
+	for i, text := range strings.Split(src, "\n") {
+		if j := strings.IndexByte(text, ';'); j >= 0 {
+			text = text[:j]
+		}
+		text = strings.TrimSpace(text)
+		if j := strings.IndexByte(text, ':'); j >= 0 {
+			label := strings.TrimSpace(text[:j])
+			if !isLabel(label) {
+				return nil, &AssemblyError{i + 1, fmt.Errorf("invalid label %q", label)}
+			}
+			if _, ok := labels[label]; ok {
+				return nil, &AssemblyError{i + 1, fmt.Errorf("label %q is already defined", label)}
+			}
+			labels[label] = uint16(addr)
+			text = strings.TrimSpace(text[j+1:])
+		}
+		if text == "" {
+			continue
+		}
+
+		s := statement{line: i + 1, mnemonic: text}
+		if j := strings.IndexAny(text, " \t"); j >= 0 {
+			s.mnemonic = text[:j]
+			s.operands = splitOperands(text[j:])
+		}
+		statements = append(statements, s)
+		if strings.EqualFold(s.mnemonic, "DB") {
+			addr += len(s.operands)
+		} else {
+			addr += 2
+		}
+	}
+
+	var program []byte
+	for _, s := range statements {
+		b, err := assembleStatement(s, labels)
+		if err != nil {
+			return nil, &AssemblyError{s.line, err}
+		}
+		program = append(program, b...)
+	}
+	return program, nil
+}
+
+// LoadSource assembles src with Assemble and loads the program at 0x200,
+// as LoadBytes does, to try out a program without assembling it first. It
+// fails without loading anything if the program doesn't fit in memory.
+func (c *CPU) LoadSource(src string) (int, error) {
+	b, err := Assemble(src)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.checkAddress(0x200, len(b)); err != nil {
+		return 0, err
+	}
+	return c.LoadBytes(b)
+}
+
+// assembleStatement returns the bytes for a single statement.
+func assembleStatement(s statement, labels map[string]uint16) ([]byte, error) {
+	switch strings.ToUpper(s.mnemonic) {
+	case "DB":
+		if len(s.operands) == 0 {
+			return nil, errors.New("DB needs at least one byte")
+		}
+		b := make([]byte, len(s.operands))
+		for i, operand := range s.operands {
+			v, err := operandValue(operand, 0xFF, nil)
+			if err == errNoMatch {
+				return nil, fmt.Errorf("invalid byte %q", operand)
+			}
+			if err != nil {
+				return nil, err
+			}
+			b[i] = byte(v)
+		}
+		return b, nil
+	case "DW":
+		if len(s.operands) != 1 {
+			return nil, errors.New("DW needs one word")
+		}
+		v, err := operandValue(s.operands[0], 0xFFFF, labels)
+		if err == errNoMatch {
+			return nil, fmt.Errorf("invalid word %q", s.operands[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []byte{byte(v >> 8), byte(v)}, nil
+	}
+
+	known := false
+	var valueErr error
+	for _, op := range knownOpcodes {
+		if !strings.EqualFold(op.spec.Mnemonic, s.mnemonic) {
+			continue
+		}
+		known = true
+		opcode, err := assembleSpec(op.spec, s.operands, labels)
+		if err == nil {
+			return []byte{byte(opcode >> 8), byte(opcode)}, nil
+		}
+		if err != errNoMatch && valueErr == nil {
+			valueErr = err
+		}
+	}
+	switch {
+	case !known:
+		return nil, fmt.Errorf("unknown instruction %q", s.mnemonic)
+	case valueErr != nil:
+		return nil, valueErr
+	default:
+		return nil, fmt.Errorf("invalid operands for %s: %q", strings.ToUpper(s.mnemonic), strings.Join(s.operands, ", "))
+	}
+}
+
+// assembleSpec encodes operands as the instruction described by spec. It
+// returns errNoMatch if they don't fit its syntax, and another error if
+// they do but a value is out of range or a label is undefined.
+func assembleSpec(spec OpcodeSpec, operands []string, labels map[string]uint16) (uint16, error) {
+	var want []string
+	if i := strings.IndexByte(spec.Syntax, ' '); i >= 0 {
+		want = splitOperands(spec.Syntax[i:])
+	}
+	if len(operands) != len(want) {
+		return 0, errNoMatch
+	}
+
+	opcode := spec.Pattern
+	for i, w := range want {
+		operand := operands[i]
+		switch w {
+		case "V{x}", "V{y}":
+			r, ok := register(operand)
+			if !ok {
+				return 0, errNoMatch
+			}
+			if w == "V{x}" {
+				opcode |= uint16(r) << 8
+			} else {
+				opcode |= uint16(r) << 4
+			}
+		case "{x}":
+			// A bare X is a hex digit, as in the disassembly.
+			x, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(operand), "0x"), 16, 4)
+			if err != nil {
+				return 0, errNoMatch
+			}
+			opcode |= uint16(x) << 8
+		case "{n}":
+			v, err := operandValue(operand, 0xF, nil)
+			if err != nil {
+				return 0, err
+			}
+			opcode |= v
+		case "{nn}":
+			v, err := operandValue(operand, 0xFF, nil)
+			if err != nil {
+				return 0, err
+			}
+			opcode |= v
+		case "{nnn}":
+			v, err := operandValue(operand, 0xFFF, labels)
+			if err != nil {
+				return 0, err
+			}
+			opcode |= v
+		default:
+			if !strings.EqualFold(operand, w) {
+				return 0, errNoMatch
+			}
+		}
+	}
+	return opcode, nil
+}
+
+// operandValue parses a number up to max, or, if labels isn't nil, a label.
+// An operand that is neither gives errNoMatch.
+func operandValue(operand string, max uint16, labels map[string]uint16) (uint16, error) {
+	v, err := strconv.ParseUint(operand, 0, 16)
+	if err != nil {
+		if labels == nil || !isLabel(operand) {
+			return 0, errNoMatch
+		}
+		addr, ok := labels[operand]
+		if !ok {
+			return 0, fmt.Errorf("undefined label %q", operand)
+		}
+		v = uint64(addr)
+	}
+	if v > uint64(max) {
+		return 0, fmt.Errorf("%s is out of range, the most is 0x%X", operand, max)
+	}
+	return uint16(v), nil
+}
+
+// register parses a register name, V0 to VF.
+func register(operand string) (byte, bool) {
+	if len(operand) != 2 || (operand[0] != 'V' && operand[0] != 'v') {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(operand[1:], 16, 4)
+	return byte(r), err == nil
+}
+
+// splitOperands splits a comma separated operand list, trimming spaces.
+func splitOperands(s string) []string {
+	operands := strings.Split(s, ",")
+	for i := range operands {
+		operands[i] = strings.TrimSpace(operands[i])
+	}
+	return operands
+}
+
+// isLabel reports whether s can be used as a label: a letter or underscore
+// followed by letters, digits and underscores.
+func isLabel(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssemble(t *testing.T) {
+	b, err := Assemble(`
+; Draws a digit forever.
+start:
+	ld v0, 7        ; the digit
+	LD F, V0
+	LD V1, 0x0A
+	drw V1, V1, 5
+	JP end
+sprite: DB 0x80, 128, 0b1
+	DW 0x1234
+end:	jp start
+	SKP VA
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x60, 0x07,
+		0xF0, 0x29,
+		0x61, 0x0A,
+		0xD1, 0x15,
+		0x12, 0x0F,
+		0x80, 0x80, 0x01,
+		0x12, 0x34,
+		0x12, 0x00,
+		0xEA, 0x9E,
+	}, b)
+}
+
+func TestAssemble_errors(t *testing.T) {
+	cases := []struct {
+		src  string
+		line int
+		msg  string
+	}{
+		{"CLS\nFOO V1", 2, `chip8: line 2: unknown instruction "FOO"`},
+		{"LD V1, 0x100", 1, "chip8: line 1: 0x100 is out of range, the most is 0xFF"},
+		{"\n\nJP nowhere", 3, `chip8: line 3: undefined label "nowhere"`},
+		{"ADD V1, I", 1, `chip8: line 1: invalid operands for ADD: "V1, I"`},
+		{"DRW V0, V1", 1, `chip8: line 1: invalid operands for DRW: "V0, V1"`},
+		{"a:\na: CLS", 2, `chip8: line 2: label "a" is already defined`},
+		{"1a: CLS", 1, `chip8: line 1: invalid label "1a"`},
+		{"DB 1, x", 1, `chip8: line 1: invalid byte "x"`},
+	}
+	for _, c := range cases {
+		_, err := Assemble(c.src)
+		if assert.IsType(t, &AssemblyError{}, err, c.src) {
+			assert.Equal(t, c.line, err.(*AssemblyError).Line)
+			assert.EqualError(t, err, c.msg)
+		}
+	}
+}
+
+func TestAssemble_disassembly(t *testing.T) {
+	// Everything the disassembler prints assembles back to the same opcode.
+	for op := 0; op <= 0xFFFF; op++ {
+		src := DisassembleOpcode(uint16(op))
+		b, err := Assemble(src)
+		if !assert.NoError(t, err, src) || !assert.Equal(t, []byte{byte(op >> 8), byte(op)}, b, src) {
+			return
+		}
+	}
+}
+
+func TestCPU_LoadSource(t *testing.T) {
+	cpu := NewCPU(nil)
+	n, err := cpu.LoadSource(`
+	LD V0, 3
+	LD V1, 0
+loop:
+	ADD V1, 5
+	ADD V0, 0xFF ; decrement
+	SE V0, 0
+	JP loop
+done:
+	JP done
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 14, n)
+
+	assert.NoError(t, cpu.RunN(2+3*4))
+	assert.Equal(t, byte(0), cpu.V[0])
+	assert.Equal(t, byte(15), cpu.V[1])
+	assert.Equal(t, uint16(0x20C), cpu.ProgramCounter)
+
+	// A program that doesn't assemble leaves the old one alone.
+	program := append([]byte(nil), cpu.Memory[0x200:0x200+n]...)
+	_, err = cpu.LoadSource("LD V1, 1\nLD V2, 2\nJP 0x1000")
+	assert.EqualError(t, err, "chip8: line 3: 0x1000 is out of range, the most is 0xFFF")
+	assert.Equal(t, program, cpu.Memory[0x200:0x200+n])
+}
@@ -2,13 +2,32 @@ package chip8
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Memory layout of the interpreter area below 0x200.
+const (
+	// FontAddress is where FONT is loaded. FX29 points I into it.
+	FontAddress = 0x000
+
+	// BigFontAddress is where BIGFONT is loaded, directly after FONT.
+	// FX30 points I into it.
+	BigFontAddress = 0x050
+
+	// fontEnd is the address just past BIGFONT.
+	fontEnd = BigFontAddress + 100
+)
+
 var FONT = [80]byte{
 	// Fontz.
 	0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
@@ -29,11 +48,28 @@ var FONT = [80]byte{
 	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
 }
 
+// BIGFONT is the SCHIP 8x10 font for the digits 0-9.
+var BIGFONT = [100]byte{
+	0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C, // 0
+	0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, // 1
+	0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF, // 2
+	0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C, // 3
+	0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06, // 4
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C, // 5
+	0x3E, 0x7C, 0xC0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C, // 6
+	0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60, // 7
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C, // 8
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C, // 9
+}
+
 var (
 	// DefaultKeypad is the default Keypad to use for input. The default is
 	// to always return 0x01.
 	DefaultKeypad Keypad = NullKeypad
 
+	// DefaultBuzzer is the default Buzzer to sound the tone with.
+	DefaultBuzzer Buzzer = BellBuzzer
+
 	// DefaultDisplay is the default Display to render graphics data to.
 	DefaultDisplay Display = NullDisplay
 
@@ -41,6 +77,13 @@ var (
 	// operated at 60 Hz.
 	DefaultClockSpeed = time.Duration(60) // Hz
 
+	// DefaultMemorySize is the amount of memory of the original CHIP-8.
+	DefaultMemorySize = 4096 // Bytes
+
+	// FrameRate is the rate at which the delay and sound timers count
+	// down, and at which the display is refreshed when draws are coalesced.
+	FrameRate = time.Duration(60) // Hz
+
 	// DefaultOptions is the default set of options that's used when calling
 	// NewCPU.
 	DefaultOptions = &Options{
@@ -50,14 +93,111 @@ var (
 )
 
 type Options struct {
+	// Preset bundles the settings of a platform. The clock speed and
+	// quirks of the preset are used unless set explicitly. PresetSCHIP and
+	// PresetXOCHIP also enable the SUPER-CHIP opcodes 00FE, 00FF and FX30,
+	// and PresetXOCHIP the XO-CHIP opcodes F001, F002 and FX3A, which are
+	// otherwise unknown.
+	Preset Preset
+
+	// ClockSpeed is the number of instructions executed per second. If it
+	// isn't positive, the preset's or else DefaultClockSpeed is used.
 	ClockSpeed time.Duration
+
+	// Quirks selects interpreter specific behaviour.
+	Quirks Quirks
+
+	// MemorySize is the amount of memory in bytes, for modelling variants
+	// with more or less than DefaultMemorySize. It must be larger than
+	// 0x200 and at most 0x10000.
+	MemorySize int
+
+	// ClearBeforeLoad zeroes the program area of memory and the registers
+	// before each Load, so a smaller program doesn't run into the remains
+	// of a larger one loaded earlier.
+	ClearBeforeLoad bool
+
+	// ByteSwap swaps the bytes of every 16-bit word as programs are loaded,
+	// for running ROM dumps that were stored little-endian.
+	ByteSwap bool
+
+	// Trace, if set, receives one disassembled line per executed
+	// instruction, followed by the registers it changed.
+	Trace io.Writer
+
+	// Logger receives structured debug events, such as each dispatched
+	// opcode. If nil, nothing is logged.
+	Logger *slog.Logger
+
+	// Timing supplies the ticks of the CPU's clock and frames. Use
+	// TimingFrom to drive them from a TimeSource. If nil, real time is
+	// used.
+	Timing Timing
+
+	// Profile records how often each kind of instruction executes, for
+	// OpcodeHistogram.
+	Profile bool
+
+	// RewindDepth is the number of instructions StepBack can undo. Before
+	// each instruction, the registers are copied into a buffer of this many
+	// snapshots, along with the memory the instruction goes on to
+	// overwrite. The screen is only copied when it changed since the last
+	// snapshot. Zero disables StepBack.
+	RewindDepth int
+
+	// TargetFPS, if positive, runs the CPU in frames: at each of TargetFPS
+	// frames per second, it executes the frame's share of ClockSpeed
+	// instructions back to back, counts the timers down and draws. This
+	// keeps the pace steady when individual ticks are late, and leaves
+	// Clock nil. If zero, each instruction runs on its own clock tick.
+	TargetFPS int
+
+	// CoalesceDraws defers rendering so that the display is drawn at most
+	// once per frame, no matter how many sprites are drawn in it.
+	CoalesceDraws bool
+
+	// YieldEvery, if positive, makes the CPU yield after every YieldEvery
+	// instructions, so a long run of instructions, such as a frame with
+	// TargetFPS, doesn't hold on to a single-threaded host like WASM. It
+	// yields by calling Yield, or runtime.Gosched if Yield is nil.
+	YieldEvery int
+
+	// Yield is called to yield with YieldEvery. It is called between
+	// instructions while Run holds the CPU, so it must not call Pause,
+	// Resume, Reload, StepBack or SetSpeedMultiplier.
+	Yield func()
+
+	// ProtectFont makes FONT and BIGFONT read-only: instructions writing
+	// to them leave memory unchanged, so a stray FX33 or FX55 can't
+	// corrupt the digits drawn with FX29 and FX30.
+	ProtectFont bool
+
+	// NoFont leaves FONT and BIGFONT out of memory at startup, so the
+	// memory below 0x200 starts out zeroed, for ROMs that bring their own
+	// font at 0x000.
+	NoFont bool
+
+	// MegaChip enables the MegaChip opcodes. The CPU starts in CHIP-8 mode
+	// until the program switches to MegaChip mode with 0011. The SUPER-CHIP
+	// opcodes are enabled too.
+	MegaChip bool
+
+	// Color enables the color extension opcodes, 02A0 and BXYN, which set
+	// the colors of the screen. BXYN replaces BNNN.
+	Color bool
+
+	// Rand is the source of the random numbers drawn by CXNN. If nil, the
+	// global math/rand source is used. Seeding it makes runs repeatable; it
+	// isn't safe to share between CPUs running at the same time.
+	Rand *rand.Rand
 }
 
 type CPU struct {
-	// 4096 bytes of memory.
-	Memory [4096]byte
+	// Memory, DefaultMemorySize bytes unless configured otherwise.
+	Memory []byte
 
-	// Registers
+	// Registers. Register and SetRegister check the index, and are safer
+	// for debuggers and UIs taking it from user input.
 	V [16]byte
 
 	// Index Register
@@ -66,7 +206,8 @@ type CPU struct {
 	// Program counter
 	ProgramCounter uint16
 
-	// Stack
+	// Stack holds the return addresses of up to 16 nested CALLs, the
+	// innermost at Stack[StackPointer-1]. StackPointer is the number held.
 	Stack        [16]uint16
 	StackPointer byte
 
@@ -77,31 +218,268 @@ type CPU struct {
 	DelayTimer byte
 	SoundTimer byte
 
-	// Key
-	key [16]byte
+	// Key state, true while a key is held down. fed is set once the state
+	// has been set with PressKey or ReleaseKey, and pressed collects the
+	// keys that went down since the last instruction started, one bit per
+	// key, which dispatch moves to presses for the instruction.
+	keyMu   sync.Mutex
+	key     [16]bool
+	fed     bool
+	pressed uint16
+	presses uint16
+
+	// waitKey is the key FX0A saw pressed and is waiting to be released,
+	// if waiting is set, under Quirks.WaitKeyOnRelease.
+	waiting bool
+	waitKey byte
 
 	// Keypad
 	Keypad Keypad
 
+	// Buzzer sounds while the sound timer is non-zero.
+	Buzzer  Buzzer
+	buzzing bool
+
+	// audioBuffer and pitch are the XO-CHIP audio pattern and playback
+	// pitch, set with F002 and FX3A.
+	audioBuffer [16]byte
+	pitch       byte
+
+	// Quirks selects interpreter specific behaviour.
+	Quirks Quirks
+
+	// QuirkDB is consulted by ApplyProfile. If nil, DefaultQuirkDB is used.
+	QuirkDB *QuirkDB
+
+	// OnWatch is called when an instruction writes to an address added
+	// with AddWatch.
+	OnWatch func(addr uint16, old, new byte)
+	watches map[uint16]struct{}
+
+	// unknownOpcodeHandler decides what happens when an unknown opcode is
+	// encountered. See SetUnknownOpcodeHandler.
+	unknownOpcodeHandler func(opcode uint16) UnknownAction
+
+	// keypadErrorHandler decides whether a keypad error stops the CPU.
+	// See SetKeypadErrorHandler.
+	keypadErrorHandler func(err error) (fatal bool)
+
+	// opcodes are the handlers added with RegisterOpcode.
+	opcodes []opcodeHandler
+
+	// OnStackError, if set, is called instead of stopping the CPU when a
+	// CALL overflows the stack or a RET underflows it, to debug programs
+	// with unbalanced calls. Execution continues: an overflowing CALL
+	// replaces the top of the stack, and an underflowing RET does nothing.
+	OnStackError func(err *StackError)
+
+	// OnRegisterChange is called for each V register an instruction
+	// changes, in register order.
+	OnRegisterChange func(reg int, old, new byte)
+
 	Clock <-chan time.Time
-	stop  chan struct{}
+
+	// Frame ticks at FrameRate. The timers count down and coalesced draws
+	// are flushed on each tick. With Options.TargetFPS it ticks at
+	// TargetFPS instead, and drives the instructions too.
+	Frame <-chan time.Time
+
+	// instructions and timerTicks pace the instructions and timers over
+	// the frames when Options.TargetFPS is set.
+	instructions, timerTicks pacer
+
+	// frameInstructions paces the instructions over the frames run with
+	// RunFrame.
+	frameInstructions pacer
+
+	// clockInstructions paces the instructions over the Clock ticks, so a
+	// tick runs more or fewer than one with a speed multiplier.
+	clockInstructions pacer
+
+	stop chan struct{}
+
+	// runCtx is the context of the running RunContext, canceled when it
+	// returns, so keypads reading in the background stop with it. It is
+	// nil outside RunContext.
+	runCtx context.Context
+
+	// runMu is held by RunContext while it executes instructions, so the
+	// run loop can be paused between them.
+	runMu sync.Mutex
+
+	// paused is set between Pause and Resume.
+	paused bool
+
+	// collisions counts the sprite draws that collided.
+	collisions uint64
+
+	// cycles counts the instructions executed.
+	cycles uint64
+
+	// histogram counts the instructions executed by opcode pattern, if
+	// Options.Profile is set.
+	histogram map[uint16]uint64
+
+	// history holds the snapshots for StepBack, if Options.RewindDepth is
+	// set.
+	history *history
+
+	// dirty is set when the graphics changed but haven't been drawn.
+	dirty bool
+
+	// mega is the MegaChip state, used when Options.MegaChip is set.
+	mega megaChip
+
+	// options the CPU was created with, after defaults were applied.
+	options Options
 }
 
+// NewCPU returns a new CPU configured by options. If options is nil,
+// DefaultOptions is used. Invalid settings fall back to their defaults.
 func NewCPU(options *Options) *CPU {
+	if options == nil {
+		options = DefaultOptions
+	}
+	opts := *options
+	applyPreset(&opts)
+	if opts.ClockSpeed <= 0 {
+		opts.ClockSpeed = DefaultClockSpeed
+	}
+	if opts.MemorySize <= 0x200 || opts.MemorySize > 0x10000 {
+		opts.MemorySize = DefaultMemorySize
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.DiscardHandler)
+	}
+	if opts.Timing == nil {
+		opts.Timing = TimingFrom(RealTime)
+	}
+
 	cpu := &CPU{
+		Memory:         make([]byte, opts.MemorySize),
 		ProgramCounter: 0x200,
-		Clock:          time.Tick(time.Second / options.ClockSpeed),
 		stop:           make(chan struct{}),
+		pitch:          DefaultPitch,
+		Quirks:         opts.Quirks,
+		options:        opts,
+	}
+	if opts.Profile {
+		cpu.histogram = make(map[uint16]uint64)
+	}
+	if opts.RewindDepth > 0 {
+		cpu.history = newHistory(opts.RewindDepth)
 	}
+	if opts.TargetFPS > 0 {
+		cpu.Frame = opts.Timing.Frame(time.Duration(opts.TargetFPS))
+		cpu.instructions = pacer{fps: opts.TargetFPS}
+		cpu.timerTicks = pacer{rate: int(FrameRate), fps: opts.TargetFPS}
+	} else {
+		cpu.Clock = opts.Timing.Clock(opts.ClockSpeed)
+		cpu.Frame = opts.Timing.Frame(FrameRate)
+	}
+	cpu.frameInstructions = pacer{fps: int(FrameRate)}
+	cpu.clockInstructions = pacer{fps: speedScale}
+	cpu.setSpeed(1)
 	cpu.ProgramCounter = 0x200
-	for i := 0; i < 80; i++ {
-		cpu.Memory[i] = FONT[i]
+	if !opts.NoFont {
+		copy(cpu.Memory[FontAddress:], FONT[:])
+		copy(cpu.Memory[BigFontAddress:], BIGFONT[:])
+	}
+	if p, ok := opts.Preset.Config(); ok {
+		cpu.Graphics.SetResolution(p.Width, p.Height)
+	}
+	if opts.Preset == PresetSCHIP || opts.Preset == PresetXOCHIP || opts.MegaChip {
+		cpu.registerSCHIP()
+	}
+	if opts.Preset == PresetXOCHIP {
+		cpu.registerXOCHIP()
+	}
+	if opts.MegaChip {
+		cpu.registerMegaChip()
+	}
+	if opts.Color {
+		cpu.registerColor()
 	}
 	return cpu
 }
 
 func (c *CPU) Load(r io.Reader) (int, error) {
-	return c.load(0x200, r)
+	if c.options.ClearBeforeLoad {
+		c.clearProgram()
+	}
+	n, err := c.load(0x200, r)
+	c.options.Logger.Debug("chip8: program loaded", "address", 0x200, "bytes", n)
+	return n, err
+}
+
+// clearProgram zeroes the program area of memory and the registers, so
+// nothing is left over from a previously loaded program.
+func (c *CPU) clearProgram() {
+	for i := range c.Memory[0x200:] {
+		c.Memory[0x200+i] = 0
+	}
+	c.resetRegisters()
+}
+
+// Reset puts the CPU back in its power-on state, as a reset button would:
+// the registers, timers, screen and statistics are cleared and execution
+// restarts at 0x200. Memory, and so the loaded program, is left alone.
+func (c *CPU) Reset() {
+	c.resetRegisters()
+	c.mega.enabled = false
+	w, h := GraphicsWidth, GraphicsHeight
+	if p, ok := c.options.Preset.Config(); ok {
+		w, h = p.Width, p.Height
+	}
+	if c.Graphics.Width() != w || c.Graphics.Height() != h {
+		c.setResolution(w, h)
+	}
+	c.Graphics.Clear()
+	c.Graphics.colors = [len(c.Graphics.colors)]byte{}
+	c.Graphics.background = 0
+	c.Graphics.planeMask = 0
+	c.dirty = false
+	c.cycles = 0
+	c.collisions = 0
+	c.audioBuffer = [16]byte{}
+	c.pitch = DefaultPitch
+	if c.histogram != nil {
+		c.histogram = make(map[uint16]uint64)
+	}
+	if c.history != nil {
+		c.history.n = 0
+		c.history.screen = nil
+	}
+	c.updateBuzzer()
+}
+
+// Reload replaces the program with b and restarts it from the power-on
+// state, as Reset and LoadBytes with ClearBeforeLoad would, e.g. to re-run
+// a ROM as it is edited. It is safe to call while Run is running: the run
+// loop is paused between instructions while the program is swapped. An
+// FX0A waiting for the Keypad holds the reload up until it gets a key.
+func (c *CPU) Reload(b []byte) error {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	c.clearProgram()
+	c.Reset()
+	n, err := c.load(0x200, bytes.NewReader(b))
+	c.options.Logger.Debug("chip8: program reloaded", "address", 0x200, "bytes", n)
+	return err
+}
+
+// resetRegisters clears the registers, stack and timers and points the
+// program counter at 0x200.
+func (c *CPU) resetRegisters() {
+	c.V = [16]byte{}
+	c.I = 0
+	c.ProgramCounter = 0x200
+	c.Stack = [16]uint16{}
+	c.StackPointer = 0
+	c.DelayTimer = 0
+	c.SoundTimer = 0
+	c.waiting = false
 }
 
 func (c *CPU) LoadBytes(b []byte) (int, error) {
@@ -109,395 +487,422 @@ func (c *CPU) LoadBytes(b []byte) (int, error) {
 
 }
 
+// LoadAt copies b into memory at offset, e.g. to place a bootloader and a
+// program, or a data table, at different addresses. Unlike Load it never
+// clears memory first. It fails without loading anything if b doesn't fit.
+func (c *CPU) LoadAt(offset uint16, b []byte) (int, error) {
+	if err := c.checkAddress(offset, len(b)); err != nil {
+		return 0, err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	return c.load(int(offset), bytes.NewReader(b))
+}
+
 func (c *CPU) load(offset int, r io.Reader) (int, error) {
-	return r.Read(c.Memory[offset:])
+	n, err := r.Read(c.Memory[offset:])
+	if c.options.ByteSwap {
+		swapBytes(c.Memory[offset : offset+n])
+	}
+	return n, err
+}
+
+// swapBytes swaps the bytes of each 16-bit word in b. A trailing odd byte is
+// left alone.
+func swapBytes(b []byte) {
+	for i := 0; i+1 < len(b); i += 2 {
+		b[i], b[i+1] = b[i+1], b[i]
+	}
+}
+
+// DumpMemory writes the whole memory space, including the interpreter area
+// holding the fonts, to w.
+func (c *CPU) DumpMemory(w io.Writer) error {
+	_, err := w.Write(c.Memory)
+	return err
+}
+
+// LoadMemoryImage replaces the whole memory space with an image written by
+// DumpMemory. The image must be exactly the size of memory; registers are
+// left alone.
+func (c *CPU) LoadMemoryImage(r io.Reader) error {
+	image := make([]byte, len(c.Memory))
+	if _, err := io.ReadFull(r, image); err != nil {
+		return fmt.Errorf("chip8: unable to read memory image: %s", err.Error())
+	}
+	if n, _ := r.Read(make([]byte, 1)); n != 0 {
+		return fmt.Errorf("chip8: memory image is larger than %d bytes", len(c.Memory))
+	}
+	c.Memory = image
+	return nil
+}
+
+// Poke sets the byte at addr, e.g. to fill in a data table before the
+// program runs. It returns an AddressError if addr is past the end of
+// memory.
+func (c *CPU) Poke(addr uint16, value byte) error {
+	if err := c.checkAddress(addr, 1); err != nil {
+		return err
+	}
+	c.Memory[addr] = value
+	return nil
+}
+
+// Peek returns the byte at addr, or an AddressError if addr is past the end
+// of memory.
+func (c *CPU) Peek(addr uint16) (byte, error) {
+	if err := c.checkAddress(addr, 1); err != nil {
+		return 0, err
+	}
+	return c.Memory[addr], nil
 }
 
 func (c *CPU) decodeOp() uint16 {
 	return uint16(c.Memory[c.ProgramCounter])<<8 | uint16(c.Memory[c.ProgramCounter+1])
 }
 
-func (c *CPU) dispatch(opcode uint16) error {
-	switch opcode & 0xF000 {
-	// 0nn - SYS addr
-	case 0x0000:
-		switch opcode {
-		case 0x00E0:
-			c.Graphics.Clear()
-			c.ProgramCounter += 2
-			break
-		case 0x00EE:
-			// Return from subroutine.
-			// Set the program counter to
-			// Address at the top of stack, then subtract
-			// one from the stack pointer.
-
-			c.ProgramCounter = c.Stack[c.StackPointer]
-			c.StackPointer--
-
-			c.ProgramCounter += 2
-			break
-		default:
-
-			return &UnknownOpcode{Opcode: opcode}
-		}
-	case 0x1000:
-		/// JUMP to location nnn
-		c.ProgramCounter = opcode & 0x0FFF
-		break
-	case 0x2000:
-		// CALL subroutine at nnn
-		c.StackPointer++
-		c.Stack[c.StackPointer] = c.ProgramCounter
-		c.ProgramCounter = opcode & 0x0FFF
-		break
-	case 0x3000:
-		// 3XNN Skips the next instruction if VX equals NN.
-		reg := (opcode & 0x0F00) >> 8
-		nn := byte(opcode)
-		c.ProgramCounter += 2
-		if c.V[reg] == nn {
-			c.ProgramCounter += 2
-		}
-		break
-	case 0x4000:
-		// 4XNN Skips the next instruction if VX doesn't equal NN.
-		reg := (opcode & 0x0F00) >> 8
-		nn := byte(opcode)
-		c.ProgramCounter += 2
-		if c.V[reg] != nn {
-			c.ProgramCounter += 2
-		}
-		break
-	case 0x5000:
-		// 5XY0 Skips the next instruction if VX equals VY.
-		x := (opcode & 0x0F00) >> 8
-		y := (opcode & 0x00F0) >> 8
-		c.ProgramCounter += 2
-		if c.V[x] == c.V[y] {
-			c.ProgramCounter += 2
+func (c *CPU) emulateCycle() (uint16, error) {
+	pc := c.ProgramCounter
+	if err := c.checkAddress(pc, 2); err != nil {
+		return 0, &ExecutionError{PC: pc, Cycle: c.cycles, Err: err}
+	}
+	if err := c.pollKeys(); err != nil {
+		if err == ErrQuit {
+			return 0, err
 		}
-		break
-	case 0x6000:
-		// 6XNN	Sets VX to NN.
-		x := (opcode & 0x0F00) >> 8
-		nn := byte(opcode)
-		c.ProgramCounter += 2
-		c.V[x] = nn
-		break
-	case 0x7000:
-		//7XNN	Adds NN to VX.
-		x := (opcode & 0x0F00) >> 8
-		kk := byte(opcode)
-		c.V[x] = c.V[x] + kk
-		c.ProgramCounter += 2
-		break
-	case 0x8000:
-		x := (opcode & 0x0F00) >> 8
-		y := (opcode & 0x00F0) >> 4
-
-		switch opcode & 0x000F {
-		case 0x0000:
-			// 8XY0	Sets VX to the value of VY.
-			c.V[x] = c.V[y]
-			c.ProgramCounter += 2
-			break
-		case 0x0001:
-			// 8XY1	Sets VX to VX or VY.
-			c.V[x] = c.V[y] | c.V[x]
-			c.ProgramCounter += 2
-			break
-		case 0x0002:
-			// 8XY2	Sets VX to VX and VY.
-			c.V[x] = c.V[y] & c.V[x]
-			c.ProgramCounter += 2
-			break
-		case 0x0003:
-			// 8XY3	Sets VX to VX xor VY.
-			c.V[x] = c.V[y] ^ c.V[x]
-			c.ProgramCounter += 2
-			break
-		case 0x0004:
-			// 8XY4	Adds VY to VX.
-			// VF is set to 1 when there's a carry,
-			// and to 0 when there isn't.
-			result := uint16(c.V[x]) + uint16(c.V[y])
-
-			var cf byte
-			if result > 0xFF {
-				cf = 1
-			}
-			c.V[0xF] = cf
-			c.V[x] = byte(result)
-			c.ProgramCounter += 2
-			break
-		case 0x0005:
-			// 0XY5 VY is subtracted from VX.
-			// VF is set to 0 when there's a borrow,
-			// and 1 when there isn't.
-
-			var cf byte
-			if c.V[x] > c.V[y] {
-				cf = 1
-			}
-			c.V[0xF] = cf
-
-			c.V[x] = c.V[x] - c.V[y]
-			c.ProgramCounter += 2
-			break
-		case 0x0006:
-			// 8XY6	Shifts VX right by one.
-			// VF is set to the value of the least significant
-			// bit of VX before the shift.
-			var cf byte
-			if (c.V[x] & 0x01) == 0x01 {
-				cf = 1
-			}
-			c.V[0xF] = cf
-			c.V[x] = c.V[x] / 2
-			c.ProgramCounter += 2
-			break
-		case 0x0007:
-			// 8XY7	Sets VX to VY minus VX.
-			// VF is set to 0 when there's a borrow,
-			// and 1 when there isn't.
-			var cf byte
-			if c.V[y] > c.V[x] {
-				cf = 1
+		return 0, &ExecutionError{PC: pc, Cycle: c.cycles, Err: err}
+	}
+	opcode := c.decodeOp()
+
+	var before [16]byte
+	beforeI := c.I
+	if c.OnRegisterChange != nil || c.options.Trace != nil {
+		before = c.V
+	}
+	if c.options.Logger.Enabled(context.Background(), slog.LevelDebug) {
+		c.options.Logger.Debug("chip8: dispatch", "pc", pc, "opcode", opcode)
+	}
+	cycle := c.cycles
+	err := c.dispatch(opcode)
+	c.cycles++
+	if n := c.options.YieldEvery; n > 0 && c.cycles%uint64(n) == 0 {
+		c.yield()
+	}
+	if c.OnRegisterChange != nil {
+		c.notifyRegisterChanges(before)
+	}
+	if c.options.Trace != nil {
+		c.trace(pc, opcode, before, beforeI)
+	}
+	if err != nil && err != ErrQuit && !c.handleUnknownOpcode(err) {
+		return opcode, &ExecutionError{PC: pc, Cycle: cycle, Opcode: opcode, Err: err}
+	}
+	if err == ErrQuit {
+		return opcode, err
+	}
+	return opcode, nil
+}
+
+// yield gives up control for Options.YieldEvery.
+func (c *CPU) yield() {
+	if c.options.Yield == nil {
+		runtime.Gosched()
+		return
+	}
+	c.options.Yield()
+}
+
+// Run runs the CPU until Stop is called or the program quits.
+func (c *CPU) Run() error {
+	return c.RunContext(context.Background())
+}
+
+// RunContext runs the CPU until ctx is done, Stop is called or the program
+// quits. It returns nil in all three cases.
+func (c *CPU) RunContext(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	c.runCtx = ctx
+	defer func() {
+		cancel()
+		c.runCtx = nil
+	}()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.stop:
+			return nil
+		case <-c.Clock:
+			c.runMu.Lock()
+			for n := c.clockInstructions.next(); n > 0 && err == nil && !c.paused; n-- {
+				_, err = c.emulateCycle()
 			}
-			c.V[0xF] = cf
-			c.V[x] = c.V[y] - c.V[x]
-
-			c.ProgramCounter += 2
-			break
-		case 0x000E:
-			// 8XYE	Shifts VX left by one.
-			// VF is set to the value of the most significant
-			// bit of VX before the shift.
-			var cf byte
-			if (c.V[x] & 0x80) == 0x80 {
-				cf = 1
+			c.runMu.Unlock()
+		case <-c.Frame:
+			c.runMu.Lock()
+			switch {
+			case c.paused:
+			case c.options.TargetFPS > 0:
+				err = c.pacedFrame()
+			default:
+				c.frame()
 			}
-			c.V[0xF] = cf
-			c.V[x] = c.V[x] * 2
-			c.ProgramCounter += 2
-			break
+			c.runMu.Unlock()
 		}
-		break
-	case 0x9000:
-		x := (opcode & 0x0F00) >> 8
-		y := (opcode & 0x00F0) >> 4
-		switch opcode & 0x000F {
-		// 9XY0 - SNE Vx, Vy
-		case 0x0000:
-			// Skip next instruction if Vx != Vy.
-			//
-			// The values of Vx and Vy are compared, and if they are
-			// not equal, the program counter is increased by 2.
-
-			c.ProgramCounter += 2
-			if c.V[x] != c.V[y] {
-				c.ProgramCounter += 2
-			}
-
-			break
-		default:
-			return &UnknownOpcode{Opcode: opcode}
+		if err == ErrQuit {
+			return nil
 		}
+		if err != nil {
+			return err
+		}
+	}
+}
 
-		break
+// Collisions returns the number of sprite draws that collided with pixels
+// already on screen, i.e. the number of times DXYN set VF.
+func (c *CPU) Collisions() uint64 {
+	return c.collisions
+}
 
-	case 0xA000:
-		// ANNN: Sets I to the address NNN
-		c.I = opcode & 0x0FFF
-		c.ProgramCounter += 2
-		break
-	case 0xB000:
-		// BNNN	Jumps to the address NNN plus V0.
-		c.ProgramCounter = opcode&0x0FFF + uint16(c.V[0])
-		break
-	case 0xC000:
-		// CXNN	Sets VX to the result of a bitwise and operation on a random number and NN.
-		x := (opcode & 0x0F00) >> 8
-		kk := byte(opcode)
-		c.V[x] = kk + byte(rand.New(rand.NewSource(time.Now().UnixNano())).Intn(255))
+// Cycles returns the number of instructions the CPU has executed. While an
+// instruction executes, it is the number executed before it.
+func (c *CPU) Cycles() uint64 {
+	return c.cycles
+}
 
-		c.ProgramCounter += 2
-		break
-	case 0xD000:
-		// DXYN	Draws a sprite at coordinate (VX, VY) that has a width of 8 pixels
-		// and a height of N pixels. Each row of 8 pixels is read as bit-coded starting
-		// from memory location I; I value doesn’t change after the execution of this instruction.
-		// As described above, VF is set to 1 if any screen pixels are flipped from set to unset when
-		// the sprite is drawn, and to 0 if that doesn’t happen
-
-		var cf byte
-		x := c.V[(opcode&0x0F00)>>8]
-		y := c.V[(opcode&0x00F0)>>4]
-		n := opcode & 0x000F
-
-		if c.Graphics.WriteSprite(c.Memory[c.I:c.I+n], x, y) {
-			cf = 0x01
-		}
+// OpcodeHistogram returns how many times each kind of instruction has
+// executed, keyed by the Pattern of its OpcodeSpec, e.g. 0xD000 for DXYN
+// and 0x8004 for 8XY4. Opcodes added with RegisterOpcode are keyed by the
+// pattern they were registered with. It returns nil unless Options.Profile
+// is set.
+func (c *CPU) OpcodeHistogram() map[uint16]uint64 {
+	if c.histogram == nil {
+		return nil
+	}
+	h := make(map[uint16]uint64, len(c.histogram))
+	for k, v := range c.histogram {
+		h[k] = v
+	}
+	return h
+}
 
-		c.V[0xF] = cf
-		c.ProgramCounter += 2
-		c.Graphics.Draw()
-		break
-	case 0xE000:
-		x := (opcode & 0x0F00) >> 8
-		switch opcode & 0x00FF {
-		case 0x9E:
-			// EX9E	Skips the next instruction if the key stored in VX is pressed.
-			c.ProgramCounter += 2
-
-			b, err := c.getKey()
-			if err != nil {
-				return err
-			}
+// Step executes the instruction at the program counter and returns its
+// error, if any. Unlike RunN, ErrQuit is returned as is.
+func (c *CPU) Step() error {
+	_, err := c.emulateCycle()
+	return err
+}
 
-			if c.V[x] == b {
-				c.ProgramCounter += 2
+// RunN executes exactly n instructions as fast as possible, ignoring the
+// clock. It returns early if an instruction fails or the program quits.
+func (c *CPU) RunN(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := c.emulateCycle(); err != nil {
+			if err == ErrQuit {
+				return nil
 			}
-			break
-		case 0xA1:
-			// EXA1	Skips the next instruction if the key stored in VX isn't pressed.
-			c.ProgramCounter += 2
-			b, err := c.getKey()
-			if err != nil {
-				return err
-			}
-			if c.V[x] != b {
-				c.ProgramCounter += 2
-			}
-			break
-		default:
-			return &UnknownOpcode{Opcode: opcode}
+			return err
 		}
-	case 0xF000:
-		x := (opcode & 0x0F00) >> 8
-		switch opcode & 0x00FF {
-		case 0x07:
-			// FX07	Sets VX to the value of the delay timer.
-			c.V[x] = c.DelayTimer
-			c.ProgramCounter += 2
-			break
-		case 0x0A:
-			// FX0A	A key press is awaited, and then stored in VX.
-			b, err := c.getKey()
-			if err != nil {
-				return err
-			}
+	}
+	return nil
+}
 
-			c.V[x] = b
-			c.ProgramCounter += 2
-			break
-		case 0x15:
-			// FX15	Sets the delay timer to VX.
-			c.DelayTimer = c.V[x]
-			c.ProgramCounter += 2
-			break
-		case 0x18:
-			// FX16 Sets the sound timer to the value of Vx
-			c.SoundTimer = c.V[x]
-			c.ProgramCounter += 2
-			break
-		case 0x1E:
-			// FX1E	Adds VX to I.
-			c.I = c.I + uint16(c.V[x])
-			c.ProgramCounter += 2
-			break
-		case 0x29:
-			// FX29	 Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
-			c.I = uint16(c.V[x]) * uint16(0x05)
-			c.ProgramCounter += 2
-			break
-		case 0x33:
-			// FX33	Stores the binary-coded decimal representation of VX,
-			// with the most significant of three digits at the address in I,
-			// the middle digit at I plus 1,
-			// and the least significant digit at I plus 2. (In other words,
-			// take the decimal representation of VX, place the hundreds digit in memory at location in I,
-			// the tens digit at location I+1, and the ones digit at location I+2.)
-			c.Memory[c.I] = c.V[x] / 100
-			c.Memory[c.I+1] = (c.V[x] / 10) % 10
-			c.Memory[c.I+2] = (c.V[x] % 100) % 10
-			c.ProgramCounter += 2
-			break
-		case 0x55:
-			//FX55	Stores V0 to VX (including VX) in memory starting at address I.[4]
-			for i := 0; uint16(i) <= x; i++ {
-				c.Memory[c.I+uint16(i)] = c.V[i]
-			}
-			c.ProgramCounter += 2
-			break
-		case 0x65:
-			// Fills V0 to VX (including VX) with values from memory starting at address I.[4]
-			for i := 0; byte(i) <= byte(x); i++ {
-				c.V[uint16(i)] = c.Memory[c.I+uint16(i)]
-			}
-			c.ProgramCounter += 2
-			break
-		default:
-			return &UnknownOpcode{Opcode: opcode}
-		}
+// speedScale is the resolution of speed multipliers: a multiplier is
+// rounded to a whole number of instructions per speedScale clock ticks.
+const speedScale = 1000
+
+// SetSpeedMultiplier scales the clock speed by m while the CPU runs, e.g.
+// 2 to fast-forward or 0.5 for slow motion. It applies to Run, RunContext
+// and RunFrame, and takes effect from their next tick without restarting
+// them. The timers keep counting down at FrameRate. If m isn't positive,
+// the speed goes back to normal.
+func (c *CPU) SetSpeedMultiplier(m float64) {
+	if !(m > 0) {
+		m = 1
+	}
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	c.setSpeed(m)
+}
 
-	default:
-		return &UnknownOpcode{Opcode: opcode}
+// setSpeed sets the rates of the instruction pacers for a speed multiplier
+// of m.
+func (c *CPU) setSpeed(m float64) {
+	rate := int(math.Round(float64(c.options.ClockSpeed) * m))
+	c.instructions.rate = rate
+	c.frameInstructions.rate = rate
+	c.clockInstructions.rate = int(math.Round(m * speedScale))
+}
+
+// RunFrame executes one frame's worth of instructions, i.e. the clock
+// speed divided by FrameRate, spread evenly when it doesn't divide, as fast
+// as possible. It then counts the timers down once and draws, and returns.
+// This lets front-ends that run their own frame loop drive the CPU instead
+// of Run. Unlike RunN, ErrQuit is returned as is. While the CPU is paused,
+// RunFrame does nothing. It is safe to call Pause, Resume and
+// SetSpeedMultiplier from other goroutines meanwhile.
+func (c *CPU) RunFrame() error {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	if c.paused {
+		return nil
+	}
+	for n := c.frameInstructions.next(); n > 0; n-- {
+		if _, err := c.emulateCycle(); err != nil {
+			return err
+		}
 	}
+	c.frame()
 	return nil
 }
 
-func (c *CPU) emulateCycle() (uint16, error) {
-	opcode := c.decodeOp()
+// frame counts the timers down and draws the graphics if they changed since
+// the last frame.
+func (c *CPU) frame() {
+	c.tickTimers()
+	c.flush()
+}
 
-	if err := c.dispatch(opcode); err != nil {
-		return opcode, err
+// pacedFrame runs a frame when Options.TargetFPS is set: the frame's share
+// of instructions, then as many timer ticks as fall in it.
+func (c *CPU) pacedFrame() error {
+	for n := c.instructions.next(); n > 0; n-- {
+		if _, err := c.emulateCycle(); err != nil {
+			return err
+		}
 	}
+	for n := c.timerTicks.next(); n > 0; n-- {
+		c.tickTimers()
+	}
+	c.flush()
+	return nil
+}
+
+// tickTimers counts the timers down by one.
+func (c *CPU) tickTimers() {
 	if c.DelayTimer > 0 {
 		c.DelayTimer--
 	}
 	if c.SoundTimer > 0 {
-		if c.SoundTimer == 1 {
-			fmt.Print('\a')
-		}
 		c.SoundTimer--
 	}
-	return opcode, nil
+	c.updateBuzzer()
 }
 
-func (c *CPU) Run() error {
-	for {
-		select {
-		case <-c.stop:
-			return nil
-		case <-c.Clock:
-			_, err := c.emulateCycle()
-			if err != nil {
-				if err == ErrQuit {
-					return nil
-				}
-				return err
-			}
-			//log.Printf("op=0x%04X %s\n", op, c)
-		}
+// flush draws the graphics if they changed since the last frame.
+func (c *CPU) flush() {
+	if c.dirty {
+		c.dirty = false
+		c.render()
 	}
-	return nil
 }
+
+// pacer spreads rate events per second evenly over fps frames per second.
+type pacer struct {
+	rate, fps, acc int
+}
+
+// next returns the number of events in the next frame.
+func (p *pacer) next() int {
+	p.acc += p.rate
+	n := p.acc / p.fps
+	p.acc %= p.fps
+	return n
+}
+
+// draw draws the graphics after an instruction changed them, or defers it
+// to the next frame if draws are coalesced.
+func (c *CPU) draw() {
+	if c.options.CoalesceDraws {
+		c.dirty = true
+		return
+	}
+	c.render()
+}
+
+// setResolution changes the resolution of the graphics and tells the
+// display, if it is ResolutionAware.
+func (c *CPU) setResolution(width, height int) {
+	c.Graphics.SetResolution(width, height)
+	if d, ok := c.Graphics.display().(ResolutionAware); ok {
+		d.SetResolution(c.Graphics.Width(), c.Graphics.Height())
+	}
+}
+
+// render draws the graphics, waiting for vsync if the display supports it.
+func (c *CPU) render() {
+	if v, ok := c.Graphics.display().(VSyncer); ok {
+		v.WaitForVSync()
+	}
+	c.Graphics.Draw()
+}
+
+// Pause freezes a running CPU until Resume is called: no instructions are
+// executed, the delay and sound timers stop counting down, and the buzzer
+// is silenced. The program stays where it is.
+func (c *CPU) Pause() {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	c.paused = true
+	c.updateBuzzer()
+}
+
+// Resume carries on after Pause, sounding the buzzer again if the sound
+// timer is still running.
+func (c *CPU) Resume() {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	c.paused = false
+	c.updateBuzzer()
+}
+
+// Paused reports whether the CPU is paused.
+func (c *CPU) Paused() bool {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	return c.paused
+}
+
 func (c *CPU) Stop() {
 	close(c.stop)
 }
-func (c *CPU) getKey() (byte, error) {
-	b, err := c.keypad().GetKey()
-	if err != nil {
-		if err == ErrQuit {
-			return b, err
-		}
 
-		return b, fmt.Errorf("chip8: unable to get key from keypad: %s", err.Error())
+// getKey asks the keypad for a key. It returns false if the keypad failed
+// and the error isn't fatal, in which case the key should be asked for
+// again later.
+func (c *CPU) getKey() (byte, bool, error) {
+	b, err := c.keypad().GetKey()
+	if err == nil {
+		return b, true, nil
+	}
+	if err == ErrQuit {
+		return b, false, err
+	}
+	if !c.keypadErrorFatal(err) {
+		c.options.Logger.Debug("chip8: keypad error skipped", "error", err)
+		return b, false, nil
 	}
+	return b, false, fmt.Errorf("chip8: unable to get key from keypad: %w", err)
+}
+
+// SetKeypadErrorHandler sets fn to decide whether an error from the Keypad
+// stops the CPU. If fn returns false, the key is skipped and FX0A asks for
+// it again on the next cycle. ErrQuit always stops the CPU. Passing nil
+// restores the default, where ErrNoKeypad and ErrScriptExhausted are fatal,
+// as no key will ever come, and other errors, such as a passing hiccup
+// reading the terminal, are skipped.
+func (c *CPU) SetKeypadErrorHandler(fn func(err error) (fatal bool)) {
+	c.keypadErrorHandler = fn
+}
 
-	return b, nil
+func (c *CPU) keypadErrorFatal(err error) bool {
+	if c.keypadErrorHandler != nil {
+		return c.keypadErrorHandler(err)
+	}
+	return errors.Is(err, ErrNoKeypad) || errors.Is(err, ErrScriptExhausted)
 }
 
 func (c *CPU) keypad() Keypad {
@@ -515,3 +920,102 @@ type UnknownOpcode struct {
 func (e *UnknownOpcode) Error() string {
 	return fmt.Sprintf("chip8: unknown opcode: 0x%04X", e.Opcode)
 }
+
+// ExecutionError is returned when an instruction fails. It records where
+// and when, and wraps the error of the instruction.
+type ExecutionError struct {
+	PC     uint16
+	Cycle  uint64
+	Opcode uint16
+	Err    error
+}
+
+func (e *ExecutionError) Error() string {
+	return fmt.Sprintf("chip8: at 0x%04X (cycle %d, opcode 0x%04X): %s",
+		e.PC, e.Cycle, e.Opcode, strings.TrimPrefix(e.Err.Error(), "chip8: "))
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownAction tells the CPU how to proceed after an unknown opcode.
+type UnknownAction int
+
+const (
+	// UnknownAbort stops execution with an UnknownOpcode error.
+	UnknownAbort UnknownAction = iota
+
+	// UnknownSkip skips the opcode and continues with the next instruction.
+	UnknownSkip
+)
+
+// SetUnknownOpcodeHandler sets a handler that is called with each unknown
+// opcode, instead of aborting straight away. Passing nil restores the
+// default of aborting.
+func (c *CPU) SetUnknownOpcodeHandler(fn func(opcode uint16) UnknownAction) {
+	c.unknownOpcodeHandler = fn
+}
+
+// handleUnknownOpcode consults the unknown opcode handler if err is an
+// UnknownOpcode. It reports whether execution should continue.
+func (c *CPU) handleUnknownOpcode(err error) bool {
+	e, ok := err.(*UnknownOpcode)
+	if !ok || c.unknownOpcodeHandler == nil {
+		return false
+	}
+
+	switch c.unknownOpcodeHandler(e.Opcode) {
+	case UnknownSkip:
+		c.ProgramCounter += 2
+		return true
+	default:
+		return false
+	}
+}
+
+// AddressError is returned when an instruction accesses memory past the end
+// of the address space.
+type AddressError struct {
+	Address int
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("chip8: address out of bounds: 0x%04X", e.Address)
+}
+
+// StackError is returned when a CALL overflows the stack or a RET is
+// executed with an empty stack.
+type StackError struct {
+	// Overflow is true for an overflow and false for an underflow.
+	Overflow bool
+}
+
+func (e *StackError) Error() string {
+	if e.Overflow {
+		return "chip8: stack overflow"
+	}
+	return "chip8: stack underflow"
+}
+
+// stackError reports a stack overflow or underflow. It returns the
+// StackError, unless OnStackError is set to handle it, in which case it
+// returns nil and the instruction carries on.
+func (c *CPU) stackError(overflow bool) error {
+	err := &StackError{Overflow: overflow}
+	if c.OnStackError == nil {
+		return err
+	}
+	c.options.Logger.Debug("chip8: stack error", "error", err, "pc", c.ProgramCounter)
+	c.OnStackError(err)
+	return nil
+}
+
+// checkAddress returns an AddressError unless the n bytes starting at addr
+// are all in memory.
+func (c *CPU) checkAddress(addr uint16, n int) error {
+	if end := int(addr) + n; end > len(c.Memory) {
+		return &AddressError{Address: end - 1}
+	}
+	return nil
+}
@@ -2,7 +2,9 @@ package chip8
 
 import (
 	"bytes"
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,6 +15,55 @@ func TestNewCPU(t *testing.T) {
 	assert.Equal(t, byte(0x90), cpu.Memory[3])
 }
 
+func TestNewCPU_NoFont(t *testing.T) {
+	cpu := NewCPU(&Options{NoFont: true})
+	assert.Equal(t, make([]byte, 0x50), cpu.Memory[0x000:0x050])
+
+	cpu = NewCPU(&Options{})
+	assert.Equal(t, FONT[:], cpu.Memory[0x000:0x050])
+}
+
+func TestNewCPU_nilOptions(t *testing.T) {
+	cpu := NewCPU(nil)
+	assert.Equal(t, DefaultClockSpeed, cpu.options.ClockSpeed)
+	assert.Equal(t, Quirks{}, cpu.Quirks)
+}
+
+func TestNewCPU_MemorySize(t *testing.T) {
+	assert.Len(t, NewCPU(nil).Memory, DefaultMemorySize)
+	assert.Len(t, NewCPU(&Options{MemorySize: 0x100}).Memory, DefaultMemorySize)
+
+	cpu := NewCPU(&Options{MemorySize: 0x2000})
+	assert.Len(t, cpu.Memory, 0x2000)
+	cpu.LoadBytes([]byte{
+		0xAF, 0xFF, // LD I, 0xFFF
+		0x60, 0xFF, // LD V0, 0xFF
+		0xF0, 0x1E, // ADD I, V0
+		0xF0, 0x1E, // ADD I, V0
+		0x61, 0xEE, // LD V1, 0xEE
+		0xF1, 0x55, // LD [I], V1
+		0xF0, 0x1E, // ADD I, V0
+		0xF1, 0x55, // LD [I], V1
+	})
+	if err := cpu.RunN(6); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint16(0x11FD), cpu.I)
+	assert.Equal(t, []byte{0xFF, 0xEE}, cpu.Memory[0x11FD:0x11FF])
+
+	cpu.ProgramCounter = 0x20A
+	cpu.I = 0x1FFF
+	assert.Equal(t, &ExecutionError{PC: 0x20A, Cycle: 6, Opcode: 0xF155, Err: &AddressError{Address: 0x2000}}, cpu.RunN(1))
+}
+
+func TestNewCPU_invalidClockSpeed(t *testing.T) {
+	for _, speed := range []time.Duration{0, -1} {
+		cpu := NewCPU(&Options{ClockSpeed: speed})
+		assert.Equal(t, DefaultClockSpeed, cpu.options.ClockSpeed)
+		assert.NotNil(t, cpu.Clock)
+	}
+}
+
 func TestCPU_load(t *testing.T) {
 	cpu := NewCPU(nil)
 	program := []byte{0x01, 0x02}
@@ -53,6 +104,111 @@ func TestCPU_LoadBytes(t *testing.T) {
 	assert.Equal(t, uint16(0x02), uint16(cpu.Memory[0x201]))
 }
 
+func TestCPU_LoadAt(t *testing.T) {
+	cpu := NewCPU(nil)
+
+	n, err := cpu.LoadAt(0x200, []byte{0x12, 0x34})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = cpu.LoadAt(0x800, []byte{0xAA, 0xBB, 0xCC})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	assert.Equal(t, []byte{0x12, 0x34, 0x00}, cpu.Memory[0x200:0x203])
+	assert.Equal(t, []byte{0xAA, 0xBB, 0xCC, 0x00}, cpu.Memory[0x800:0x804])
+
+	n, err = cpu.LoadAt(0xFFE, []byte{0x01, 0x02, 0x03})
+	assert.Equal(t, &AddressError{Address: 0x1000}, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, []byte{0x00, 0x00}, cpu.Memory[0xFFE:])
+
+	n, err = cpu.LoadAt(0x300, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestCPU_LoadBytes_clearBeforeLoad(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		cpu := NewCPU(&Options{ClearBeforeLoad: enabled})
+		cpu.LoadBytes([]byte{0x60, 0x01, 0x61, 0x02, 0x62, 0x03})
+		cpu.RunN(2)
+
+		cpu.LoadBytes([]byte{0x63, 0x04})
+
+		assert.Equal(t, []byte{0x63, 0x04}, cpu.Memory[0x200:0x202])
+		if enabled {
+			assert.Equal(t, make([]byte, 4), cpu.Memory[0x202:0x206])
+			assert.Equal(t, [16]byte{}, cpu.V)
+			assert.Equal(t, uint16(0x200), cpu.ProgramCounter)
+		} else {
+			assert.Equal(t, []byte{0x61, 0x02, 0x62, 0x03}, cpu.Memory[0x202:0x206])
+		}
+		assert.Equal(t, FONT[:], cpu.Memory[FontAddress:FontAddress+len(FONT)])
+	}
+}
+
+func TestCPU_LoadBytes_byteSwap(t *testing.T) {
+	cpu := NewCPU(&Options{ByteSwap: true})
+	program := []byte{0xFE, 0xC0, 0x05, 0x60, 0xAA}
+
+	instructions, err := cpu.LoadBytes(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 5, instructions)
+	assert.Equal(t, uint16(0xC0FE), cpu.decodeOp())
+	cpu.ProgramCounter += 2
+	assert.Equal(t, uint16(0x6005), cpu.decodeOp())
+	assert.Equal(t, byte(0xAA), cpu.Memory[0x204])
+
+	// The caller's program is left alone.
+	assert.Equal(t, byte(0xFE), program[0])
+}
+
+func TestCPU_DumpMemory(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{0x60, 0x05})
+	cpu.Memory[0xFFF] = 0x42
+	want := cpu.Memory
+
+	var image bytes.Buffer
+	assert.NoError(t, cpu.DumpMemory(&image))
+	assert.Equal(t, len(cpu.Memory), image.Len())
+
+	want = append([]byte(nil), want...)
+	cpu.Memory = make([]byte, len(cpu.Memory))
+	assert.NoError(t, cpu.LoadMemoryImage(&image))
+	assert.Equal(t, want, cpu.Memory)
+	assert.Equal(t, FONT[:], cpu.Memory[FontAddress:FontAddress+len(FONT)])
+}
+
+func TestCPU_LoadMemoryImage_wrongSize(t *testing.T) {
+	cpu := NewCPU(nil)
+	assert.Error(t, cpu.LoadMemoryImage(bytes.NewReader(make([]byte, 100))))
+	assert.Error(t, cpu.LoadMemoryImage(bytes.NewReader(make([]byte, len(cpu.Memory)+1))))
+	assert.Equal(t, FONT[:], cpu.Memory[FontAddress:FontAddress+len(FONT)])
+}
+
+func TestCPU_PokePeek(t *testing.T) {
+	cpu := NewCPU(nil)
+
+	assert.NoError(t, cpu.Poke(0x300, 0xAB))
+	assert.NoError(t, cpu.Poke(0xFFF, 0xCD))
+	assert.Equal(t, byte(0xAB), cpu.Memory[0x300])
+
+	b, err := cpu.Peek(0x300)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0xAB), b)
+	b, err = cpu.Peek(0xFFF)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0xCD), b)
+
+	assert.Equal(t, &AddressError{Address: 0x1000}, cpu.Poke(0x1000, 0x01))
+	b, err = cpu.Peek(0xFFFF)
+	assert.Equal(t, &AddressError{Address: 0xFFFF}, err)
+	assert.Equal(t, byte(0), b)
+}
+
 func TestCPU_decodeop(t *testing.T) {
 	cpu := NewCPU(nil)
 	cpu.Memory[0x200] = 0xC0
@@ -60,3 +216,359 @@ func TestCPU_decodeop(t *testing.T) {
 	op := cpu.decodeOp()
 	assert.Equal(t, uint16(0xC0FE), op)
 }
+
+func TestCPU_RunContext(t *testing.T) {
+	cpu := NewCPU(DefaultOptions)
+	cpu.Clock = time.Tick(time.Millisecond)
+	cpu.LoadBytes([]byte{0x12, 0x00}) // JP 0x200
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- cpu.RunContext(ctx)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("RunContext did not return after the context was cancelled")
+	}
+}
+
+func TestCPU_CoalesceDraws(t *testing.T) {
+	cpu := NewCPU(&Options{CoalesceDraws: true})
+	var renders int
+	cpu.Graphics.Display = DisplayFunc(func(*Graphics) error {
+		renders++
+		return nil
+	})
+	cpu.LoadBytes([]byte{
+		0xD0, 0x05, // DRW V0, V0, 5
+		0xD0, 0x05, // DRW V0, V0, 5
+		0xD0, 0x05, // DRW V0, V0, 5
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := cpu.emulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, 0, renders)
+
+	cpu.frame()
+	assert.Equal(t, 1, renders)
+
+	cpu.frame()
+	assert.Equal(t, 1, renders)
+}
+
+func TestCPU_overlappingDrawsInOneFrame(t *testing.T) {
+	program := []byte{
+		0xA3, 0x00, // LD I, 0x300
+		0xD0, 0x01, // DRW V0, V0, 1
+		0x81, 0xF0, // LD V1, VF
+		0x62, 0x02, // LD V2, 2
+		0xD2, 0x01, // DRW V2, V0, 1
+		0x83, 0xF0, // LD V3, VF
+		0xD2, 0x01, // DRW V2, V0, 1
+	}
+	for _, coalesce := range []bool{false, true} {
+		cpu := NewCPU(&Options{ClockSpeed: 7 * FrameRate, CoalesceDraws: coalesce})
+		var frames []string
+		cpu.Graphics.Display = DisplayFunc(func(g *Graphics) error {
+			frames = append(frames, g.String()[:8])
+			return nil
+		})
+		cpu.LoadBytes(program)
+		cpu.Memory[0x300] = 0xF0
+
+		assert.NoError(t, cpu.RunFrame())
+		// The draws apply in order: the second undraws the overlap and
+		// sets VF, and the third draws it back and undraws its own pixels.
+		assert.Equal(t, byte(0), cpu.V[1])
+		assert.Equal(t, byte(1), cpu.V[3])
+		assert.Equal(t, byte(1), cpu.V[0xF])
+		assert.Equal(t, uint64(2), cpu.Collisions())
+		if coalesce {
+			// Only the final state of the frame is drawn.
+			assert.Equal(t, []string{"####...."}, frames)
+		} else {
+			assert.Equal(t, []string{"####....", "##..##..", "####...."}, frames)
+		}
+	}
+}
+
+func TestCPU_RunN(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0x70, 0x01, // ADD V0, 0x01
+		0x12, 0x00, // JP 0x200
+	})
+
+	assert.NoError(t, cpu.RunN(9))
+	assert.Equal(t, byte(5), cpu.V[0])
+	assert.Equal(t, uint16(0x202), cpu.ProgramCounter)
+
+	cpu.LoadBytes([]byte{0xFF, 0xFF})
+	cpu.ProgramCounter = 0x200
+	assert.Error(t, cpu.RunN(1))
+}
+
+func TestCPU_YieldEvery(t *testing.T) {
+	var cpu *CPU
+	var yields []uint64
+	cpu = NewCPU(&Options{
+		ClockSpeed: 600,
+		YieldEvery: 4,
+		Yield:      func() { yields = append(yields, cpu.Cycles()) },
+	})
+	cpu.LoadBytes([]byte{
+		0x70, 0x01, // ADD V0, 0x01
+		0x12, 0x00, // JP 0x200
+	})
+
+	assert.NoError(t, cpu.RunN(10))
+	assert.Equal(t, []uint64{4, 8}, yields)
+
+	// A frame of 10 instructions yields along the way.
+	assert.NoError(t, cpu.RunFrame())
+	assert.Equal(t, []uint64{4, 8, 12, 16, 20}, yields)
+}
+
+func BenchmarkCPU_RunN(b *testing.B) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0x70, 0x01, // ADD V0, 0x01
+		0x81, 0x04, // ADD V1, V0
+		0x12, 0x00, // JP 0x200
+	})
+
+	b.ResetTimer()
+	if err := cpu.RunN(b.N); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "instructions/s")
+}
+
+func TestCPU_FX29_fontLayout(t *testing.T) {
+	cpu := NewCPU(nil)
+	assert.Equal(t, BIGFONT[:], cpu.Memory[BigFontAddress:BigFontAddress+len(BIGFONT)])
+
+	for digit := byte(0); digit <= 0x0F; digit++ {
+		cpu.LoadBytes([]byte{0xF0, 0x29}) // LD F, V0
+		cpu.ProgramCounter = 0x200
+		cpu.V[0] = digit
+		if _, err := cpu.emulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.True(t, cpu.I <= 0x04F-4, "digit %X at 0x%03X", digit, cpu.I)
+		assert.Equal(t, FONT[digit*5:digit*5+5], cpu.Memory[cpu.I:cpu.I+5])
+	}
+}
+
+func TestCPU_ExecutionError(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0x60, 0x01, // LD V0, 0x01
+		0x12, 0x06, // JP 0x206
+		0x00, 0x00, // skipped
+		0x81, 0x0A, // unknown
+	})
+
+	err := cpu.RunN(3)
+	assert.Equal(t, &ExecutionError{PC: 0x206, Cycle: 2, Opcode: 0x810A, Err: &UnknownOpcode{Opcode: 0x810A}}, err)
+	assert.EqualError(t, err, "chip8: at 0x0206 (cycle 2, opcode 0x810A): unknown opcode: 0x810A")
+
+	var unknown *UnknownOpcode
+	assert.ErrorAs(t, err, &unknown)
+	assert.Equal(t, uint16(0x810A), unknown.Opcode)
+}
+
+func TestCPU_SetUnknownOpcodeHandler(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0x00, 0x01, // unknown
+		0x60, 0x2A, // LD V0, 0x2A
+		0x00, 0x02, // unknown
+	})
+
+	var seen []uint16
+	cpu.SetUnknownOpcodeHandler(func(opcode uint16) UnknownAction {
+		seen = append(seen, opcode)
+		if opcode == 0x0001 {
+			return UnknownSkip
+		}
+		return UnknownAbort
+	})
+
+	err := cpu.RunN(3)
+	assert.Equal(t, &ExecutionError{PC: 0x204, Cycle: 2, Opcode: 0x0002, Err: &UnknownOpcode{Opcode: 0x0002}}, err)
+	assert.Equal(t, []uint16{0x0001, 0x0002}, seen)
+	assert.Equal(t, byte(0x2A), cpu.V[0])
+	assert.Equal(t, uint16(0x204), cpu.ProgramCounter)
+}
+
+func TestCPU_7XNN_leavesVF(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{0x70, 0x02}) // ADD V0, 0x02
+	cpu.V[0] = 0xFF
+	cpu.V[0xF] = 0xAA
+
+	if _, err := cpu.emulateCycle(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, byte(0x01), cpu.V[0])
+	assert.Equal(t, byte(0xAA), cpu.V[0xF])
+}
+
+func TestCPU_Collisions(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0xD0, 0x05, // DRW V0, V0, 5
+		0xD0, 0x05, // DRW V0, V0, 5 (collides, erasing the sprite)
+		0xD0, 0x05, // DRW V0, V0, 5
+		0xD0, 0x05, // DRW V0, V0, 5 (collides)
+		0x00, 0xE0, // CLS
+		0xD0, 0x05, // DRW V0, V0, 5
+	})
+
+	if err := cpu.RunN(6); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(2), cpu.Collisions())
+}
+
+func TestCPU_OpcodeHistogram(t *testing.T) {
+	assert.Nil(t, NewCPU(nil).OpcodeHistogram())
+
+	cpu := NewCPU(&Options{Profile: true})
+	cpu.LoadBytes([]byte{
+		0x60, 0x00, // LD V0, 0x00
+		0x70, 0x01, // ADD V0, 0x01
+		0x30, 0x05, // SE V0, 0x05
+		0x12, 0x02, // JP 0x202
+		0x12, 0x08, // JP 0x208
+	})
+
+	assert.NoError(t, cpu.RunN(17))
+	assert.Equal(t, map[uint16]uint64{
+		0x6000: 1,
+		0x7000: 5,
+		0x3000: 5,
+		0x1000: 6,
+	}, cpu.OpcodeHistogram())
+
+	cpu.Reset()
+	assert.Equal(t, map[uint16]uint64{}, cpu.OpcodeHistogram())
+}
+
+func TestCPU_Reset(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{
+		0x60, 0x05, // LD V0, 0x05
+		0xA3, 0x00, // LD I, 0x300
+		0xF0, 0x15, // LD DT, V0
+		0x22, 0x0A, // CALL 0x20A
+		0x00, 0x00,
+		0xD0, 0x05, // DRW V0, V0, 5
+	})
+	assert.NoError(t, cpu.RunN(5))
+
+	cpu.Reset()
+	assert.Equal(t, [16]byte{}, cpu.V)
+	assert.Equal(t, uint16(0), cpu.I)
+	assert.Equal(t, uint16(0x200), cpu.ProgramCounter)
+	assert.Equal(t, byte(0), cpu.StackPointer)
+	assert.Equal(t, byte(0), cpu.DelayTimer)
+	assert.Equal(t, uint64(0), cpu.Cycles())
+	assert.Equal(t, 0, cpu.Graphics.CountOnPixels())
+	// The program is still loaded.
+	assert.Equal(t, []byte{0x60, 0x05}, cpu.Memory[0x200:0x202])
+}
+
+func TestCPU_RunFrame(t *testing.T) {
+	cpu := NewCPU(&Options{ClockSpeed: 600})
+	cpu.LoadBytes([]byte{
+		0x70, 0x01, // ADD V0, 1
+		0x12, 0x00, // JP 0x200
+	})
+	cpu.DelayTimer = 10
+
+	assert.NoError(t, cpu.RunFrame())
+	assert.Equal(t, uint64(10), cpu.Cycles())
+	assert.Equal(t, byte(5), cpu.V[0])
+	assert.Equal(t, byte(9), cpu.DelayTimer)
+
+	assert.NoError(t, cpu.RunFrame())
+	assert.Equal(t, uint64(20), cpu.Cycles())
+	assert.Equal(t, byte(8), cpu.DelayTimer)
+
+	// 500 Hz doesn't divide into frames, so the extra instructions are
+	// spread out.
+	cpu = NewCPU(&Options{ClockSpeed: 500})
+	cpu.LoadBytes([]byte{0x12, 0x00}) // JP 0x200
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, cpu.RunFrame())
+	}
+	assert.Equal(t, uint64(25), cpu.Cycles())
+}
+
+func TestCPU_RunFrameConcurrentPause(t *testing.T) {
+	// A front-end's UI goroutine pauses and changes speed while its frame
+	// loop runs; the race detector checks RunFrame holds the lock.
+	cpu := NewCPU(&Options{ClockSpeed: 600})
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{0x12, 0x00}) // JP 0x200
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			cpu.Pause()
+			cpu.SetSpeedMultiplier(float64(i%3 + 1))
+			cpu.Resume()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, cpu.RunFrame())
+	}
+	<-done
+}
+
+func TestCPU_Reload(t *testing.T) {
+	ft := newFakeTime()
+	cpu := NewCPU(&Options{Timing: TimingFrom(ft)})
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{
+		0x70, 0x01, // ADD V0, 1
+		0x61, 0xAA, // LD V1, 0xAA
+		0xA2, 0x22, // LD I, 0x222
+		0x12, 0x00, // JP 0x200
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- cpu.Run()
+	}()
+
+	ft.Advance(time.Second)
+	assert.NoError(t, cpu.Reload([]byte{
+		0x72, 0x01, // ADD V2, 1
+		0x12, 0x00, // JP 0x200
+	}))
+	ft.Advance(time.Second)
+	cpu.Stop()
+	assert.NoError(t, <-done)
+
+	assert.Equal(t, byte(0), cpu.V[0])
+	assert.Equal(t, byte(0), cpu.V[1])
+	assert.Equal(t, uint16(0), cpu.I)
+	assert.Equal(t, byte(30), cpu.V[2])
+	assert.Equal(t, make([]byte, 4), cpu.Memory[0x204:0x208])
+}
@@ -0,0 +1,64 @@
+// Package chip8test provides helpers for testing programs and front ends
+// built on the chip8 package.
+package chip8test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scottjab/go-chip8/chip8"
+)
+
+// TestingT is the part of *testing.T used by the helpers.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// AssertScreen checks that the screen of cpu matches expected, which is
+// drawn as in Graphics.String: one line per row, '#' for pixels that are on
+// and '.' for pixels that are off. Leading and trailing blank lines and the
+// indentation of each line are ignored, so expected can be an indented raw
+// string literal. Rows and columns that expected leaves out must be off.
+//
+// On a mismatch, it reports every row that differs.
+func AssertScreen(t TestingT, cpu *chip8.CPU, expected string) bool {
+	t.Helper()
+
+	g := &cpu.Graphics
+	got := strings.Split(strings.TrimSuffix(g.String(), "\n"), "\n")
+	want := screenLines(expected, g.Width(), g.Height())
+	if len(want) > len(got) {
+		t.Errorf("screen mismatch: expected %d rows, screen has %d", len(want), len(got))
+		return false
+	}
+
+	var diff strings.Builder
+	for y := range got {
+		if got[y] != want[y] {
+			fmt.Fprintf(&diff, "row %2d: want %s\n        got  %s\n", y, want[y], got[y])
+		}
+	}
+	if diff.Len() > 0 {
+		t.Errorf("screen mismatch:\n%s", diff.String())
+		return false
+	}
+	return true
+}
+
+// screenLines parses an expected screen, padding it to width x height
+// with pixels that are off.
+func screenLines(s string, width, height int) []string {
+	lines := strings.Split(strings.Trim(s, "\n"), "\n")
+	for i, l := range lines {
+		l = strings.TrimLeft(l, " \t")
+		if pad := width - len(l); pad > 0 {
+			l += strings.Repeat(".", pad)
+		}
+		lines[i] = l
+	}
+	for len(lines) < height {
+		lines = append(lines, strings.Repeat(".", width))
+	}
+	return lines
+}
@@ -0,0 +1,74 @@
+package chip8test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/scottjab/go-chip8/chip8"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT records the errors reported through it.
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+// drawDigit returns a CPU that has drawn the font digit d at (1, 1).
+func drawDigit(d byte) *chip8.CPU {
+	cpu := chip8.NewCPU(nil)
+	cpu.Graphics.Display = chip8.NullDisplay
+	cpu.LoadBytes([]byte{
+		0x60, d, // LD V0, d
+		0xF0, 0x29, // LD F, V0
+		0x61, 0x01, // LD V1, 0x01
+		0xD1, 0x15, // DRW V1, V1, 5
+	})
+	if err := cpu.RunN(4); err != nil {
+		panic(err)
+	}
+	return cpu
+}
+
+func TestAssertScreen(t *testing.T) {
+	AssertScreen(t, drawDigit(0x0), `
+		......
+		.####.
+		.#..#.
+		.#..#.
+		.#..#.
+		.####.
+	`)
+}
+
+func TestAssertScreen_mismatch(t *testing.T) {
+	rt := &recordingT{}
+	ok := AssertScreen(rt, drawDigit(0x1), `
+		......
+		.####.
+		.#..#.
+		.#..#.
+		.#..#.
+		.####.
+	`)
+
+	assert.False(t, ok)
+	row := func(s string) string {
+		return s + strings.Repeat(".", chip8.GraphicsWidth-len(s))
+	}
+	if assert.Len(t, rt.errors, 1) {
+		assert.Equal(t, "screen mismatch:\n"+
+			"row  1: want "+row(".####.")+"\n        got  "+row("...#..")+"\n"+
+			"row  2: want "+row(".#..#.")+"\n        got  "+row("..##..")+"\n"+
+			"row  3: want "+row(".#..#.")+"\n        got  "+row("...#..")+"\n"+
+			"row  4: want "+row(".#..#.")+"\n        got  "+row("...#..")+"\n"+
+			"row  5: want "+row(".####.")+"\n        got  "+row("..###.")+"\n",
+			rt.errors[0])
+	}
+}
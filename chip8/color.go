@@ -0,0 +1,133 @@
+package chip8
+
+import (
+	"image"
+	"image/color"
+)
+
+// Colors of the CHIP-8 color extension, as used by the COSMAC VIP color
+// board. They index ColorPalette.
+const (
+	ColorBlack byte = iota
+	ColorRed
+	ColorBlue
+	ColorViolet
+	ColorGreen
+	ColorYellow
+	ColorAqua
+	ColorWhite
+
+	// DefaultColor is the color of zones that haven't been colored.
+	DefaultColor = ColorWhite
+)
+
+// ColorPalette maps colors to RGB.
+var ColorPalette = [8]color.RGBA{
+	ColorBlack:  {0x00, 0x00, 0x00, 0xFF},
+	ColorRed:    {0xFF, 0x00, 0x00, 0xFF},
+	ColorBlue:   {0x00, 0x00, 0xFF, 0xFF},
+	ColorViolet: {0xFF, 0x00, 0xFF, 0xFF},
+	ColorGreen:  {0x00, 0xFF, 0x00, 0xFF},
+	ColorYellow: {0xFF, 0xFF, 0x00, 0xFF},
+	ColorAqua:   {0x00, 0xFF, 0xFF, 0xFF},
+	ColorWhite:  {0xFF, 0xFF, 0xFF, 0xFF},
+}
+
+// backgroundColors are the background colors 02A0 steps through.
+var backgroundColors = [4]byte{ColorBlack, ColorBlue, ColorGreen, ColorRed}
+
+// SetColor sets the color of the 8x1 zone containing the pixel at the
+// given coordinates. Pixels that are on are drawn in their zone's color.
+// Only the low three bits of c are used. Coordinates off the screen are
+// ignored.
+func (g *Graphics) SetColor(x, y uint16, c byte) {
+	if z, ok := g.zone(x, y); ok {
+		g.colors[z] = c&0x07 + 1
+		g.changes++
+	}
+}
+
+// Color returns the color of the 8x1 zone containing the pixel at the
+// given coordinates.
+func (g *Graphics) Color(x, y uint16) byte {
+	z, ok := g.zone(x, y)
+	if !ok || g.colors[z] == 0 {
+		return DefaultColor
+	}
+	return g.colors[z] - 1
+}
+
+// Background returns the color that pixels that are off are drawn in.
+func (g *Graphics) Background() byte {
+	return backgroundColors[g.background]
+}
+
+// zone returns the index of the color zone containing the pixel at the
+// given coordinates, and false if they are off the screen.
+func (g *Graphics) zone(x, y uint16) (int, bool) {
+	if _, ok := g.addr(x, y); !ok {
+		return 0, false
+	}
+	return int(x)/8 + int(y)*((g.Width()+7)/8), true
+}
+
+// RenderColorTo is like RenderTo, but draws pixels that are on in the color
+// of their zone and pixels that are off in the background color, using
+// ColorPalette.
+func (g *Graphics) RenderColorTo(img *image.RGBA, scale int) {
+	if scale < 1 {
+		scale = 1
+	}
+	b := img.Bounds()
+	bg := ColorPalette[g.Background()]
+	g.ScaledEachPixel(scale, func(x, y int, on bool) {
+		p := image.Pt(x, y).Add(b.Min)
+		if !p.In(b) {
+			return
+		}
+		c := bg
+		if on {
+			c = ColorPalette[g.Color(uint16(x/scale), uint16(y/scale))]
+		}
+		img.SetRGBA(p.X, p.Y, c)
+	})
+}
+
+// registerColor adds the color extension opcodes to the CPU.
+func (c *CPU) registerColor() {
+	c.RegisterOpcode(0xFFFF, 0x02A0, (*CPU).opBGCOLOR)
+	c.RegisterOpcode(0xF000, 0xB000, (*CPU).opCOLOR)
+}
+
+// 02A0	Steps the background color through black, blue, green and red.
+func (c *CPU) opBGCOLOR(opcode uint16) error {
+	c.Graphics.background = (c.Graphics.background + 1) % byte(len(backgroundColors))
+	c.Graphics.changes++
+	c.ProgramCounter += 2
+	c.draw()
+	return nil
+}
+
+// BXYN	Colors the 8x1 zones of N rows in VY, starting with the zone
+// containing (VX, VX+1). With N = 0, it colors a block of 8x4 zones
+// instead: the columns of 8 pixels from the low to the high nibble of VX,
+// and the rows of 4 pixels from the low to the high nibble of VX+1. This
+// replaces BNNN.
+func (c *CPU) opCOLOR(opcode uint16) error {
+	x, y := xy(opcode)
+	vx, vx1, col := c.V[x], c.V[(x+1)&0x0F], c.V[y]
+	if n := opcode & 0x000F; n != 0 {
+		for row := uint16(0); row < n; row++ {
+			c.Graphics.SetColor(uint16(vx), uint16(vx1)+row, col)
+		}
+	} else {
+		for zx := int(vx & 0x0F); zx <= int(vx>>4); zx++ {
+			for py := int(vx1&0x0F) * 4; py < (int(vx1>>4)+1)*4; py++ {
+				c.Graphics.SetColor(uint16(zx*8), uint16(py), col)
+			}
+		}
+	}
+	c.ProgramCounter += 2
+	c.draw()
+	return nil
+}
@@ -0,0 +1,85 @@
+package chip8
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphics_SetColor(t *testing.T) {
+	var g Graphics
+	assert.Equal(t, DefaultColor, g.Color(0, 0))
+
+	// The whole 8x1 zone takes the color.
+	g.SetColor(10, 3, ColorRed)
+	for x := uint16(8); x < 16; x++ {
+		assert.Equal(t, ColorRed, g.Color(x, 3), "x %d", x)
+	}
+	assert.Equal(t, DefaultColor, g.Color(7, 3))
+	assert.Equal(t, DefaultColor, g.Color(16, 3))
+	assert.Equal(t, DefaultColor, g.Color(10, 2))
+	assert.Equal(t, DefaultColor, g.Color(10, 4))
+
+	g.SetColor(63, 31, ColorBlack)
+	assert.Equal(t, ColorBlack, g.Color(56, 31))
+	g.SetColor(64, 31, ColorGreen)
+	assert.Equal(t, DefaultColor, g.Color(64, 31))
+
+	// Clearing the screen keeps the colors; changing resolution doesn't.
+	g.Clear()
+	assert.Equal(t, ColorRed, g.Color(10, 3))
+	g.SetResolution(GraphicsWidth, GraphicsHeight)
+	assert.Equal(t, DefaultColor, g.Color(10, 3))
+}
+
+func TestGraphics_RenderColorTo(t *testing.T) {
+	var g Graphics
+	g.Set(0, 0, true)
+	g.Set(8, 0, true)
+	g.SetColor(8, 0, ColorYellow)
+
+	img := image.NewRGBA(image.Rect(0, 0, GraphicsWidth, GraphicsHeight))
+	g.RenderColorTo(img, 1)
+	assert.Equal(t, ColorPalette[DefaultColor], img.RGBAAt(0, 0))
+	assert.Equal(t, ColorPalette[ColorYellow], img.RGBAAt(8, 0))
+	assert.Equal(t, ColorPalette[ColorBlack], img.RGBAAt(9, 0))
+}
+
+func TestCPU_Color(t *testing.T) {
+	cpu := NewCPU(&Options{Color: true})
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{
+		0x60, 0x0C, // LD V0, 12
+		0x61, 0x02, // LD V1, 2
+		0x62, 0x04, // LD V2, green
+		0xB0, 0x23, // COLOR V0, V2, 3
+		0x02, 0xA0, // BGCOLOR
+	})
+
+	assert.NoError(t, cpu.RunN(4))
+	assert.Equal(t, DefaultColor, cpu.Graphics.Color(12, 1))
+	assert.Equal(t, ColorGreen, cpu.Graphics.Color(12, 2))
+	assert.Equal(t, ColorGreen, cpu.Graphics.Color(15, 4))
+	assert.Equal(t, DefaultColor, cpu.Graphics.Color(12, 5))
+	assert.Equal(t, DefaultColor, cpu.Graphics.Color(16, 2))
+
+	assert.Equal(t, ColorBlack, cpu.Graphics.Background())
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, ColorBlue, cpu.Graphics.Background())
+
+	// BXY0 colors a block of 8x4 zones.
+	cpu.V[0] = 0x21 // columns 1 to 2
+	cpu.V[1] = 0x10 // rows 0 to 1
+	cpu.V[2] = ColorViolet
+	assert.NoError(t, cpu.ExecuteOpcode(0xB020))
+	assert.Equal(t, ColorViolet, cpu.Graphics.Color(8, 0))
+	assert.Equal(t, ColorViolet, cpu.Graphics.Color(23, 7))
+	assert.Equal(t, DefaultColor, cpu.Graphics.Color(7, 0))
+	assert.Equal(t, DefaultColor, cpu.Graphics.Color(24, 0))
+	assert.Equal(t, DefaultColor, cpu.Graphics.Color(8, 8))
+
+	cpu.Reset()
+	assert.Equal(t, DefaultColor, cpu.Graphics.Color(8, 0))
+	assert.Equal(t, ColorBlack, cpu.Graphics.Background())
+}
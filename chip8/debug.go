@@ -0,0 +1,194 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// AddWatch sets a watchpoint on addr. OnWatch is called whenever an
+// instruction writes to it.
+func (c *CPU) AddWatch(addr uint16) {
+	if c.watches == nil {
+		c.watches = make(map[uint16]struct{})
+	}
+	c.watches[addr] = struct{}{}
+}
+
+// RemoveWatch clears the watchpoint on addr.
+func (c *CPU) RemoveWatch(addr uint16) {
+	delete(c.watches, addr)
+}
+
+// writeMemory stores v at addr on behalf of an instruction, notifying
+// OnWatch if addr is watched. Writes to the fonts are dropped if they are
+// protected.
+func (c *CPU) writeMemory(addr uint16, v byte) {
+	if c.options.ProtectFont && addr < fontEnd {
+		return
+	}
+	old := c.Memory[addr]
+	if c.history != nil {
+		c.history.recordWrite(addr, old)
+	}
+	c.Memory[addr] = v
+
+	if _, ok := c.watches[addr]; !ok {
+		return
+	}
+	c.options.Logger.Debug("chip8: watchpoint hit", "address", addr, "old", old, "new", v)
+	if c.OnWatch != nil {
+		c.OnWatch(addr, old, v)
+	}
+}
+
+// notifyRegisterChanges calls OnRegisterChange for every V register that
+// differs from before.
+func (c *CPU) notifyRegisterChanges(before [16]byte) {
+	for i, v := range c.V {
+		if v != before[i] {
+			c.OnRegisterChange(i, before[i], v)
+		}
+	}
+}
+
+// trace writes the instruction at pc and the registers it changed to the
+// Trace writer.
+func (c *CPU) trace(pc, opcode uint16, before [16]byte, beforeI uint16) {
+	var b strings.Builder
+	b.WriteString(Instruction{
+		Address:  pc,
+		Opcode:   opcode,
+		Mnemonic: DisassembleOpcode(opcode),
+	}.String())
+	for i, v := range c.V {
+		if v != before[i] {
+			fmt.Fprintf(&b, " V%X=%02X", i, v)
+		}
+	}
+	if c.I != beforeI {
+		fmt.Fprintf(&b, " I=%04X", c.I)
+	}
+	b.WriteByte('\n')
+
+	fmt.Fprint(c.options.Trace, b.String())
+}
+
+// InvalidRegister is returned when a register index isn't between 0x0 and
+// 0xF.
+type InvalidRegister struct {
+	Register int
+}
+
+func (e *InvalidRegister) Error() string {
+	return fmt.Sprintf("chip8: invalid register: %d", e.Register)
+}
+
+// Register returns the value of register Vi.
+func (c *CPU) Register(i int) (byte, error) {
+	if i < 0 || i >= len(c.V) {
+		return 0, &InvalidRegister{Register: i}
+	}
+	return c.V[i], nil
+}
+
+// SetRegister sets register Vi to v.
+func (c *CPU) SetRegister(i int, v byte) error {
+	if i < 0 || i >= len(c.V) {
+		return &InvalidRegister{Register: i}
+	}
+	c.V[i] = v
+	return nil
+}
+
+// DumpString returns a readable snapshot of the CPU for bug reports: the
+// registers and timers as DebugDisplay shows them, the cycle count, the
+// stack and the screen.
+func (c *CPU) DumpString() string {
+	var b strings.Builder
+	b.WriteString(debugText(c))
+	fmt.Fprintf(&b, "cycle:%d\n", c.Cycles())
+	// The stack pointer is the number of entries.
+	b.WriteString("stack:")
+	for _, addr := range c.Stack[:min(int(c.StackPointer), len(c.Stack))] {
+		fmt.Fprintf(&b, " %04X", addr)
+	}
+	fmt.Fprintf(&b, "\nscreen %dx%d:\n", c.Graphics.Width(), c.Graphics.Height())
+	b.WriteString(c.Graphics.String())
+	return b.String()
+}
+
+// CPUState is a snapshot of the CPU for tools, in the form MarshalJSON
+// encodes it.
+type CPUState struct {
+	V              [16]byte   `json:"v"`
+	I              uint16     `json:"i"`
+	ProgramCounter uint16     `json:"pc"`
+	StackPointer   byte       `json:"sp"`
+	Stack          [16]uint16 `json:"stack"`
+	DelayTimer     byte       `json:"delayTimer"`
+	SoundTimer     byte       `json:"soundTimer"`
+	Cycles         uint64     `json:"cycles"`
+
+	// Screen is the framebuffer as encoded by Graphics.MarshalBinary, or
+	// nil if it wasn't asked for. In JSON it is base64.
+	Screen []byte `json:"screen,omitempty"`
+}
+
+// State returns a snapshot of the registers, stack and timers, and of the
+// screen too if withScreen is set.
+func (c *CPU) State(withScreen bool) CPUState {
+	s := CPUState{
+		V:              c.V,
+		I:              c.I,
+		ProgramCounter: c.ProgramCounter,
+		StackPointer:   c.StackPointer,
+		Stack:          c.Stack,
+		DelayTimer:     c.DelayTimer,
+		SoundTimer:     c.SoundTimer,
+		Cycles:         c.Cycles(),
+	}
+	if withScreen {
+		s.Screen, _ = c.Graphics.MarshalBinary()
+	}
+	return s
+}
+
+// MarshalJSON encodes the CPU's State, with the screen, as JSON.
+func (c *CPU) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.State(true))
+}
+
+// Equal reports whether c and other are in the same state: memory,
+// registers, stack, timers, the screen in every plane with its resolution
+// and colors, the XO-CHIP audio, the quirks and the instruction and
+// collision counts. Options, handlers and the keys held down aren't
+// compared. It is meant for checking that save states round-trip and that
+// runs are deterministic.
+func (c *CPU) Equal(other *CPU) bool {
+	g, o := &c.Graphics, &other.Graphics
+	return bytes.Equal(c.Memory, other.Memory) &&
+		c.V == other.V &&
+		c.I == other.I &&
+		c.ProgramCounter == other.ProgramCounter &&
+		c.Stack == other.Stack &&
+		c.StackPointer == other.StackPointer &&
+		c.DelayTimer == other.DelayTimer &&
+		c.SoundTimer == other.SoundTimer &&
+		c.waiting == other.waiting &&
+		c.waitKey == other.waitKey &&
+		c.audioBuffer == other.audioBuffer &&
+		c.pitch == other.pitch &&
+		c.cycles == other.cycles &&
+		c.collisions == other.collisions &&
+		c.mega == other.mega &&
+		c.Quirks == other.Quirks &&
+		g.Width() == o.Width() &&
+		g.Height() == o.Height() &&
+		g.pixels == o.pixels &&
+		g.pixels2 == o.pixels2 &&
+		g.colors == o.colors &&
+		g.background == o.background &&
+		g.Planes() == o.Planes()
+}
@@ -0,0 +1,280 @@
+package chip8
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPU_AddWatch(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0xA3, 0x00, // LD I, 0x300
+		0x60, 0x11, // LD V0, 0x11
+		0x61, 0x22, // LD V1, 0x22
+		0xF1, 0x55, // LD [I], V1
+		0xF1, 0x55, // LD [I], V1
+	})
+
+	type write struct {
+		addr     uint16
+		old, new byte
+	}
+	var writes []write
+	cpu.OnWatch = func(addr uint16, old, new byte) {
+		writes = append(writes, write{addr, old, new})
+	}
+	cpu.AddWatch(0x301)
+	cpu.AddWatch(0x302)
+
+	for i := 0; i < 4; i++ {
+		if _, err := cpu.emulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, []write{{0x301, 0x00, 0x22}}, writes)
+
+	cpu.RemoveWatch(0x301)
+	if _, err := cpu.emulateCycle(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, writes, 1)
+}
+
+func TestCPU_OnRegisterChange(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0x63, 0x05, // LD V3, 0x05
+		0x73, 0x02, // ADD V3, 0x02
+		0x63, 0x07, // LD V3, 0x07
+	})
+
+	type change struct {
+		reg      int
+		old, new byte
+	}
+	var changes []change
+	cpu.OnRegisterChange = func(reg int, old, new byte) {
+		changes = append(changes, change{reg, old, new})
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cpu.emulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, []change{
+		{3, 0x00, 0x05},
+		{3, 0x05, 0x07},
+	}, changes)
+}
+
+func TestCPU_Trace(t *testing.T) {
+	var trace bytes.Buffer
+	cpu := NewCPU(&Options{Trace: &trace})
+	cpu.LoadBytes([]byte{
+		0x60, 0x05, // LD V0, 0x05
+		0xA3, 0x00, // LD I, 0x300
+		0x80, 0x04, // ADD V0, V0
+		0x12, 0x00, // JP 0x200
+	})
+
+	if err := cpu.RunN(4); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ""+
+		"0200: 6005  LD V0, 0x05 V0=05\n"+
+		"0202: A300  LD I, 0x300 I=0300\n"+
+		"0204: 8004  ADD V0, V0 V0=0A\n"+
+		"0206: 1200  JP 0x200\n",
+		trace.String())
+}
+
+// recordHandler is a slog.Handler that keeps every record it handles.
+type recordHandler struct {
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.records = append(h.records, r)
+	return nil
+}
+
+func TestCPU_Logger(t *testing.T) {
+	h := &recordHandler{}
+	cpu := NewCPU(&Options{Logger: slog.New(h)})
+	cpu.LoadBytes([]byte{
+		0xA3, 0x00, // LD I, 0x300
+		0xF0, 0x55, // LD [I], V0
+	})
+	cpu.AddWatch(0x300)
+	if err := cpu.RunN(2); err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []string
+	for _, r := range h.records {
+		assert.Equal(t, slog.LevelDebug, r.Level)
+		messages = append(messages, r.Message)
+	}
+	assert.Equal(t, []string{
+		"chip8: program loaded",
+		"chip8: dispatch",
+		"chip8: dispatch",
+		"chip8: watchpoint hit",
+	}, messages)
+
+	var attrs []string
+	h.records[2].Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a.String())
+		return true
+	})
+	assert.Equal(t, []string{"pc=514", "opcode=61525"}, attrs)
+}
+
+func TestCPU_Register(t *testing.T) {
+	cpu := NewCPU(nil)
+
+	assert.NoError(t, cpu.SetRegister(0xF, 0x42))
+	v, err := cpu.Register(0xF)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x42), v)
+	assert.Equal(t, byte(0x42), cpu.V[0xF])
+
+	for _, i := range []int{-1, 16} {
+		_, err := cpu.Register(i)
+		assert.Equal(t, &InvalidRegister{Register: i}, err)
+		assert.Equal(t, &InvalidRegister{Register: i}, cpu.SetRegister(i, 1))
+	}
+}
+
+func TestCPU_ProtectFont(t *testing.T) {
+	program := []byte{
+		0xA0, 0x4E, // LD I, 0x04E
+		0xF1, 0x55, // LD [I], V1
+		0xA0, 0xB2, // LD I, 0x0B2
+		0xF2, 0x33, // LD B, V2
+	}
+	for _, protect := range []bool{false, true} {
+		cpu := NewCPU(&Options{ProtectFont: protect})
+		cpu.LoadBytes(program)
+		cpu.V[0] = 0xAA
+		cpu.V[1] = 0xBB
+		cpu.V[2] = 123
+
+		assert.NoError(t, cpu.RunN(4))
+		if protect {
+			assert.Equal(t, FONT[78:80], cpu.Memory[0x4E:0x50])
+			assert.Equal(t, BIGFONT[98:100], cpu.Memory[0xB2:0xB4])
+		} else {
+			assert.Equal(t, []byte{0xAA, 0xBB}, cpu.Memory[0x4E:0x50])
+			assert.Equal(t, []byte{1, 2}, cpu.Memory[0xB2:0xB4])
+		}
+		// Memory past the fonts is writable either way.
+		assert.Equal(t, byte(3), cpu.Memory[0xB4])
+	}
+}
+
+func TestCPU_DumpString(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{
+		0x6A, 0x42, // LD VA, 0x42
+		0xA0, 0x00, // LD I, 0x000
+		0xD0, 0x05, // DRW V0, V0, 5
+		0x22, 0x08, // CALL 0x208
+		0x12, 0x08, // JP 0x208
+	})
+	assert.NoError(t, cpu.RunN(4))
+
+	dump := cpu.DumpString()
+	assert.True(t, strings.HasPrefix(dump, debugText(cpu)))
+	assert.Contains(t, dump, "PC:0208 I:0000 SP:01 DT:00 ST:00\n")
+	assert.Contains(t, dump, "V8:00 V9:00 VA:42 VB:00")
+	assert.Contains(t, dump, "\ncycle:4\n")
+	assert.Contains(t, dump, "stack: 0206\n")
+	assert.Contains(t, dump, "screen 64x32:\n####....")
+	assert.Contains(t, dump, "\n#..#....")
+}
+
+func TestCPU_MarshalJSON(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{
+		0x6A, 0x42, // LD VA, 0x42
+		0xA2, 0x34, // LD I, 0x234
+		0x65, 0x00, // LD V5, 0x00
+		0xF5, 0x29, // LD F, V5
+		0xD0, 0x05, // DRW V0, V0, 5
+		0x22, 0x0E, // CALL 0x20E
+		0x12, 0x0E, // JP 0x20E
+	})
+	cpu.DelayTimer = 7
+	assert.NoError(t, cpu.RunN(6))
+
+	b, err := json.Marshal(cpu)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"pc":526`)
+
+	var s CPUState
+	assert.NoError(t, json.Unmarshal(b, &s))
+	assert.Equal(t, byte(0x42), s.V[0xA])
+	assert.Equal(t, uint16(0x000), s.I)
+	assert.Equal(t, uint16(0x20E), s.ProgramCounter)
+	assert.Equal(t, byte(1), s.StackPointer)
+	assert.Equal(t, uint16(0x20A), s.Stack[0])
+	assert.Equal(t, byte(7), s.DelayTimer)
+	assert.Equal(t, uint64(6), s.Cycles)
+	assert.Equal(t, cpu.State(true), s)
+
+	var g Graphics
+	assert.NoError(t, g.UnmarshalBinary(s.Screen))
+	assert.Equal(t, cpu.Graphics.String(), g.String())
+
+	assert.Nil(t, cpu.State(false).Screen)
+}
+
+func TestCPU_Equal(t *testing.T) {
+	program := []byte{
+		0xC0, 0xFF, // RND V0, 0xFF
+		0xC1, 0x1F, // RND V1, 0x1F
+		0xF0, 0x29, // LD F, V0
+		0xD0, 0x15, // DRW V0, V1, 5
+		0x70, 0x01, // ADD V0, 1
+		0x12, 0x00, // JP 0x200
+	}
+	run := func() *CPU {
+		cpu := NewCPU(&Options{Rand: rand.New(rand.NewSource(42))})
+		cpu.LoadBytes(program)
+		assert.NoError(t, cpu.RunN(60))
+		return cpu
+	}
+
+	a, b := run(), run()
+	assert.True(t, a.Equal(b))
+	assert.True(t, b.Equal(a))
+
+	b.Graphics.Set(63, 31, true)
+	assert.False(t, a.Equal(b))
+	b.Graphics.Set(63, 31, true)
+	assert.True(t, a.Equal(b))
+
+	b.Memory[0x300]++
+	assert.False(t, a.Equal(b))
+	b.Memory[0x300]--
+	assert.True(t, a.Equal(b))
+
+	// The quirks change how the rest of a run goes.
+	b.Quirks.ShiftUsesVY = true
+	assert.False(t, a.Equal(b))
+}
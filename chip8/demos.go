@@ -0,0 +1,36 @@
+package chip8
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// demos are small ROMs written for this package, so there is always
+// something to run. See demos/README.md.
+//
+//go:embed demos/*.ch8
+var demos embed.FS
+
+// DemoNames returns the names of the built-in demo ROMs, sorted.
+func DemoNames() []string {
+	files, _ := fs.Glob(demos, "demos/*.ch8")
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(path.Base(f), ".ch8"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DemoROM returns the built-in demo ROM with the given name.
+func DemoROM(name string) ([]byte, error) {
+	b, err := demos.ReadFile("demos/" + name + ".ch8")
+	if err != nil {
+		return nil, fmt.Errorf("chip8: unknown demo ROM %q", name)
+	}
+	return b, nil
+}
@@ -0,0 +1,31 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDemoROM(t *testing.T) {
+	assert.Equal(t, []string{"bounce", "counter"}, DemoNames())
+
+	for _, name := range DemoNames() {
+		rom, err := DemoROM(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		cpu := NewCPU(nil)
+		cpu.Graphics.Display = NullDisplay
+		_, err = cpu.LoadBytes(rom)
+		assert.NoError(t, err, name)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, cpu.RunFrame(), name)
+		}
+		assert.NotZero(t, cpu.Graphics.CountOnPixels(), name)
+	}
+
+	_, err := DemoROM("nope")
+	assert.Error(t, err)
+	_, err = DemoROM("../demos/bounce")
+	assert.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package chip8
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Instruction is a single disassembled instruction.
+type Instruction struct {
+	Address  uint16
+	Opcode   uint16
+	Mnemonic string
+}
+
+func (i Instruction) String() string {
+	return fmt.Sprintf("%04X: %04X  %s", i.Address, i.Opcode, i.Mnemonic)
+}
+
+// Disassemble disassembles program, which is loaded at address start, two
+// bytes at a time. A trailing odd byte is ignored.
+func Disassemble(program []byte, start uint16) []Instruction {
+	instructions := make([]Instruction, 0, len(program)/2)
+	for i := 0; i+1 < len(program); i += 2 {
+		opcode := uint16(program[i])<<8 | uint16(program[i+1])
+		instructions = append(instructions, Instruction{
+			Address:  start + uint16(i),
+			Opcode:   opcode,
+			Mnemonic: DisassembleOpcode(opcode),
+		})
+	}
+	return instructions
+}
+
+// DisassembleOpcode returns the mnemonic for a single opcode. Opcodes the
+// CPU doesn't implement are shown as data, e.g. "DW 0x0123".
+func DisassembleOpcode(opcode uint16) string {
+	op, ok := lookupOpcode(&knownOpcodeTable, opcode)
+	if !ok {
+		return fmt.Sprintf("DW 0x%04X", opcode)
+	}
+
+	x, y := xy(opcode)
+	return strings.NewReplacer(
+		"{x}", fmt.Sprintf("%X", x),
+		"{y}", fmt.Sprintf("%X", y),
+		"{nnn}", fmt.Sprintf("0x%03X", opcode&0x0FFF),
+		"{nn}", fmt.Sprintf("0x%02X", opcode&0x00FF),
+		"{n}", fmt.Sprintf("%d", opcode&0x000F),
+	).Replace(op.spec.Syntax)
+}
+
+// DisassembleAround disassembles the n instructions before the program
+// counter, the instruction at it and the n after it, for context when
+// debugging. The window is clipped to memory, so it can be shorter near
+// either end.
+func (c *CPU) DisassembleAround(n int) []Instruction {
+	pc := int(c.ProgramCounter)
+	start := pc - 2*n
+	for start < 0 {
+		start += 2
+	}
+	end := min(pc+2*n+2, len(c.Memory))
+	if start >= end {
+		return []Instruction{}
+	}
+	return Disassemble(c.Memory[start:end], uint16(start))
+}
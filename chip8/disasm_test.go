@@ -0,0 +1,74 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisassembleOpcode(t *testing.T) {
+	for opcode, want := range map[uint16]string{
+		0x00E0: "CLS",
+		0x00EE: "RET",
+		0x0123: "DW 0x0123",
+		0x1ABC: "JP 0xABC",
+		0x2ABC: "CALL 0xABC",
+		0x3A12: "SE VA, 0x12",
+		0x5120: "SE V1, V2",
+		0x5121: "DW 0x5121",
+		0x81F4: "ADD V1, VF",
+		0x81FE: "SHL V1, VF",
+		0x81FA: "DW 0x81FA",
+		0xB123: "JP V0, 0x123",
+		0xD125: "DRW V1, V2, 5",
+		0xE19E: "SKP V1",
+		0xF155: "LD [I], V1",
+		0xF165: "LD V1, [I]",
+		0xF1FF: "DW 0xF1FF",
+	} {
+		assert.Equal(t, want, DisassembleOpcode(opcode), "0x%04X", opcode)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	instructions := Disassemble([]byte{0x60, 0x05, 0x12, 0x00, 0xFF}, 0x200)
+	assert.Equal(t, []Instruction{
+		{Address: 0x200, Opcode: 0x6005, Mnemonic: "LD V0, 0x05"},
+		{Address: 0x202, Opcode: 0x1200, Mnemonic: "JP 0x200"},
+	}, instructions)
+	assert.Equal(t, "0200: 6005  LD V0, 0x05", instructions[0].String())
+}
+
+func TestCPU_DisassembleAround(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0x60, 0x01, // LD V0, 0x01
+		0x61, 0x02, // LD V1, 0x02
+		0x62, 0x03, // LD V2, 0x03
+		0x63, 0x04, // LD V3, 0x04
+		0x64, 0x05, // LD V4, 0x05
+	})
+	cpu.ProgramCounter = 0x204
+
+	window := cpu.DisassembleAround(1)
+	assert.Equal(t, []Instruction{
+		{Address: 0x202, Opcode: 0x6102, Mnemonic: "LD V1, 0x02"},
+		{Address: 0x204, Opcode: 0x6203, Mnemonic: "LD V2, 0x03"},
+		{Address: 0x206, Opcode: 0x6304, Mnemonic: "LD V3, 0x04"},
+	}, window)
+
+	addresses := func(instructions []Instruction) []uint16 {
+		a := make([]uint16, len(instructions))
+		for i, in := range instructions {
+			a[i] = in.Address
+		}
+		return a
+	}
+	assert.Equal(t, []uint16{0x200, 0x202, 0x204, 0x206, 0x208}, addresses(cpu.DisassembleAround(2)))
+
+	cpu.ProgramCounter = 0x002
+	assert.Equal(t, []uint16{0x000, 0x002, 0x004, 0x006}, addresses(cpu.DisassembleAround(2)))
+
+	cpu.ProgramCounter = 0xFFC
+	assert.Equal(t, []uint16{0xFF8, 0xFFA, 0xFFC, 0xFFE}, addresses(cpu.DisassembleAround(2)))
+}
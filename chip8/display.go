@@ -0,0 +1,182 @@
+package chip8
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MultiDisplay is a Display that renders to each of its displays in turn.
+// Every display is rendered even if an earlier one fails; the errors are
+// joined together.
+type MultiDisplay []Display
+
+// Render renders g to every display.
+func (m MultiDisplay) Render(g *Graphics) error {
+	var errs []error
+	for _, d := range m {
+		if err := d.Render(g); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// OrientedDisplay wraps a Display for screens that are mounted flipped. It
+// renders a flipped copy of the graphics, leaving the CPU's untouched.
+type OrientedDisplay struct {
+	Display Display
+
+	// FlipHorizontal and FlipVertical mirror the image left to right and
+	// top to bottom. Setting both rotates it by 180 degrees.
+	FlipHorizontal, FlipVertical bool
+}
+
+// Render renders a flipped copy of g to the wrapped display.
+func (d *OrientedDisplay) Render(g *Graphics) error {
+	flipped := *g
+	if d.FlipHorizontal {
+		flipped.FlipHorizontal()
+	}
+	if d.FlipVertical {
+		flipped.FlipVertical()
+	}
+	return d.Display.Render(&flipped)
+}
+
+// TextDisplay is implemented by displays that can show lines of text
+// alongside the graphics, such as TermboxDisplay.
+type TextDisplay interface {
+	Display
+	RenderText(text string) error
+}
+
+// DebugDisplay wraps a Display and, after each frame, shows the CPU's
+// registers, program counter, index register and timers. The text is only
+// shown if the wrapped display implements TextDisplay.
+type DebugDisplay struct {
+	Display Display
+	CPU     *CPU
+}
+
+// NewDebugDisplay returns a DebugDisplay showing the state of cpu on d.
+func NewDebugDisplay(d Display, cpu *CPU) *DebugDisplay {
+	return &DebugDisplay{
+		Display: d,
+		CPU:     cpu,
+	}
+}
+
+// Render renders g to the wrapped display followed by the CPU state.
+func (d *DebugDisplay) Render(g *Graphics) error {
+	if err := d.Display.Render(g); err != nil {
+		return err
+	}
+
+	td, ok := d.Display.(TextDisplay)
+	if !ok {
+		return nil
+	}
+	return td.RenderText(debugText(d.CPU))
+}
+
+// debugText formats the registers, program counter, index register, stack
+// pointer and timers of c.
+func debugText(c *CPU) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "PC:%04X I:%04X SP:%02X DT:%02X ST:%02X\n",
+		c.ProgramCounter, c.I, c.StackPointer, c.DelayTimer, c.SoundTimer)
+	for i, v := range c.V {
+		fmt.Fprintf(&b, "V%X:%02X", i, v)
+		if i%8 == 7 {
+			b.WriteByte('\n')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// ANSIDisplay is an implementation of the Display interface that renders the
+// graphics array to any io.Writer using ANSI escape codes. Unlike
+// TermboxDisplay it doesn't take over the terminal, so its output can be
+// captured or mixed with logging.
+type ANSIDisplay struct {
+	// On and Off are the characters drawn for lit and unlit pixels.
+	On, Off rune
+
+	// OnColor and OffColor are SGR parameters selecting the colors of lit
+	// and unlit pixels, e.g. "32" for green or "38;5;208" for orange. If
+	// empty, the terminal's current colors are used.
+	OnColor, OffColor string
+
+	w io.Writer
+}
+
+// NewANSIDisplay returns an ANSIDisplay writing to w.
+func NewANSIDisplay(w io.Writer) *ANSIDisplay {
+	return &ANSIDisplay{
+		On:  '█',
+		Off: ' ',
+		w:   w,
+	}
+}
+
+// Render writes the graphics array to the writer, one escape positioned
+// line per row.
+func (d *ANSIDisplay) Render(g *Graphics) error {
+	bw := bufio.NewWriter(d.w)
+	color := ""
+	g.EachPixel(func(x, y uint16, addr int) {
+		if x == 0 {
+			fmt.Fprintf(bw, "\x1b[%d;1H", y+1)
+		}
+
+		r, c := d.Off, d.OffColor
+		if g.lit(addr) {
+			r, c = d.On, d.OnColor
+		}
+		if c != color {
+			if color != "" {
+				bw.WriteString("\x1b[0m")
+			}
+			if c != "" {
+				fmt.Fprintf(bw, "\x1b[%sm", c)
+			}
+			color = c
+		}
+		bw.WriteRune(r)
+	})
+	if color != "" {
+		bw.WriteString("\x1b[0m")
+	}
+	return bw.Flush()
+}
+
+// LogDisplay is an implementation of the Display interface that writes each
+// frame as text, for headless runs such as CI that need a reviewable record
+// of what was drawn. Every frame starts with a "--- frame N ---" marker,
+// counting from 1, followed by the screen as drawn by Graphics.String.
+type LogDisplay struct {
+	w      io.Writer
+	frames int
+}
+
+// NewLogDisplay returns a LogDisplay writing to w.
+func NewLogDisplay(w io.Writer) *LogDisplay {
+	return &LogDisplay{w: w}
+}
+
+// Render writes g to the log as the next frame.
+func (d *LogDisplay) Render(g *Graphics) error {
+	d.frames++
+	_, err := fmt.Fprintf(d.w, "--- frame %d ---\n%s", d.frames, g.String())
+	return err
+}
+
+// Frames returns the number of frames written.
+func (d *LogDisplay) Frames() int {
+	return d.frames
+}
@@ -0,0 +1,156 @@
+package chip8
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiDisplay_Render(t *testing.T) {
+	var a, b int
+	errA := errors.New("a failed")
+	d := MultiDisplay{
+		DisplayFunc(func(*Graphics) error {
+			a++
+			return errA
+		}),
+		DisplayFunc(func(*Graphics) error {
+			b++
+			return nil
+		}),
+	}
+
+	var g Graphics
+	g.Display = d
+	assert.True(t, errors.Is(g.Draw(), errA))
+	assert.True(t, errors.Is(g.Draw(), errA))
+	assert.Equal(t, 2, a)
+	assert.Equal(t, 2, b)
+
+	assert.NoError(t, MultiDisplay{NullDisplay, NullDisplay}.Render(&g))
+}
+
+func TestDebugDisplay_debugText(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.ProgramCounter = 0x2A4
+	cpu.I = 0x050
+	cpu.StackPointer = 2
+	cpu.DelayTimer = 0x10
+	cpu.SoundTimer = 0x03
+	for i := range cpu.V {
+		cpu.V[i] = byte(i * 0x11)
+	}
+
+	assert.Equal(t, ""+
+		"PC:02A4 I:0050 SP:02 DT:10 ST:03\n"+
+		"V0:00 V1:11 V2:22 V3:33 V4:44 V5:55 V6:66 V7:77\n"+
+		"V8:88 V9:99 VA:AA VB:BB VC:CC VD:DD VE:EE VF:FF\n",
+		debugText(cpu))
+}
+
+type textDisplay struct {
+	frames int
+	text   string
+}
+
+func (d *textDisplay) Render(*Graphics) error {
+	d.frames++
+	return nil
+}
+
+func (d *textDisplay) RenderText(text string) error {
+	d.text = text
+	return nil
+}
+
+func TestDebugDisplay_Render(t *testing.T) {
+	cpu := NewCPU(nil)
+	td := &textDisplay{}
+	cpu.Graphics.Display = NewDebugDisplay(td, cpu)
+
+	assert.NoError(t, cpu.Graphics.Draw())
+	assert.Equal(t, 1, td.frames)
+	assert.Equal(t, debugText(cpu), td.text)
+
+	// Displays without text support are still rendered.
+	cpu.Graphics.Display = NewDebugDisplay(NullDisplay, cpu)
+	assert.NoError(t, cpu.Graphics.Draw())
+}
+
+func TestANSIDisplay_Render(t *testing.T) {
+	var buf bytes.Buffer
+	d := NewANSIDisplay(&buf)
+	d.On, d.Off = '#', '.'
+
+	var g Graphics
+	g.WriteSprite([]byte{0xC0}, 1, 0)
+	assert.NoError(t, d.Render(&g))
+
+	rows := strings.Split(buf.String(), "\x1b[")
+	assert.Equal(t, "", rows[0])
+	assert.Equal(t, "1;1H.##"+strings.Repeat(".", 61), rows[1])
+	assert.Equal(t, "2;1H"+strings.Repeat(".", 64), rows[2])
+	assert.Equal(t, "32;1H"+strings.Repeat(".", 64), rows[32])
+	assert.Len(t, rows, 33)
+
+	buf.Reset()
+	d.OnColor = "32"
+	assert.NoError(t, d.Render(&g))
+	assert.True(t, strings.HasPrefix(buf.String(), "\x1b[1;1H.\x1b[32m##\x1b[0m..."))
+	assert.True(t, strings.HasSuffix(buf.String(), "\x1b[32;1H"+strings.Repeat(".", 64)))
+
+	buf.Reset()
+	d.OffColor = "40"
+	assert.NoError(t, d.Render(&g))
+	assert.True(t, strings.HasPrefix(buf.String(), "\x1b[1;1H\x1b[40m.\x1b[0m\x1b[32m##\x1b[0m\x1b[40m..."))
+	assert.True(t, strings.HasSuffix(buf.String(), "...\x1b[0m"))
+}
+
+func TestOrientedDisplay_Render(t *testing.T) {
+	var g Graphics
+	g.Set(0, 0, true)
+	g.Set(1, 0, true)
+
+	var got *Graphics
+	d := &OrientedDisplay{
+		Display: DisplayFunc(func(g *Graphics) error {
+			got = g
+			return nil
+		}),
+		FlipHorizontal: true,
+		FlipVertical:   true,
+	}
+	assert.NoError(t, d.Render(&g))
+
+	assert.True(t, got.GetPixel(63, 31))
+	assert.True(t, got.GetPixel(62, 31))
+	assert.False(t, got.GetPixel(0, 0))
+	// The original graphics are untouched.
+	assert.True(t, g.GetPixel(0, 0))
+	assert.False(t, g.GetPixel(63, 31))
+}
+
+func TestLogDisplay_Render(t *testing.T) {
+	var b strings.Builder
+	d := NewLogDisplay(&b)
+	cpu := NewCPU(nil)
+	cpu.Graphics.Display = d
+	cpu.LoadBytes([]byte{
+		0xD0, 0x05, // DRW V0, V0, 5
+		0x00, 0xE0, // CLS
+		0xD0, 0x05, // DRW V0, V0, 5
+	})
+
+	assert.NoError(t, cpu.RunN(3))
+	assert.Equal(t, 3, d.Frames())
+	assert.Equal(t, 3, strings.Count(b.String(), "--- frame"))
+
+	frames := strings.Split(b.String(), "--- frame ")
+	assert.True(t, strings.HasPrefix(frames[1], "1 ---\n####...."))
+	assert.True(t, strings.HasPrefix(frames[2], "2 ---\n........"))
+	assert.True(t, strings.HasPrefix(frames[3], "3 ---\n####...."))
+	assert.Equal(t, 1+GraphicsHeight, strings.Count(frames[3], "\n"))
+}
@@ -0,0 +1,93 @@
+//go:build ebiten
+
+package chip8
+
+import (
+	"errors"
+	"image"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// EbitenGame runs a CPU as an Ebiten game, for a windowed front-end. Each
+// Update runs a frame with RunFrame, Draw shows the framebuffer, and the
+// keys in KeyMap are passed to PressKey and ReleaseKey.
+//
+// As the key state is fed before every frame, FX0A waits for one of the
+// keys to go down, or to be released under Quirks.WaitKeyOnRelease, and
+// the CPU's Keypad isn't used.
+//
+// It is only built with the ebiten build tag:
+//
+//	go build -tags ebiten
+type EbitenGame struct {
+	CPU *CPU
+
+	// KeyMap maps keyboard keys to CHIP-8 keys. If nil, the same QWERTY
+	// layout as the TermboxKeypad is used.
+	KeyMap map[ebiten.Key]byte
+
+	// OnColor and OffColor are the colors pixels are drawn in.
+	OnColor, OffColor color.RGBA
+
+	// img is the framebuffer as an image, reused from frame to frame.
+	img *image.RGBA
+}
+
+// NewEbitenGame returns an EbitenGame for cpu, drawing white on black. Run
+// it with ebiten.RunGame.
+func NewEbitenGame(cpu *CPU) *EbitenGame {
+	return &EbitenGame{
+		CPU:      cpu,
+		OnColor:  color.RGBA{0xFF, 0xFF, 0xFF, 0xFF},
+		OffColor: color.RGBA{0x00, 0x00, 0x00, 0xFF},
+	}
+}
+
+var ebitenKeyMap = map[ebiten.Key]byte{
+	ebiten.Key1: 0x01, ebiten.Key2: 0x02, ebiten.Key3: 0x03, ebiten.Key4: 0x0C,
+	ebiten.KeyQ: 0x04, ebiten.KeyW: 0x05, ebiten.KeyE: 0x06, ebiten.KeyR: 0x0D,
+	ebiten.KeyA: 0x07, ebiten.KeyS: 0x08, ebiten.KeyD: 0x09, ebiten.KeyF: 0x0E,
+	ebiten.KeyZ: 0x0A, ebiten.KeyX: 0x00, ebiten.KeyC: 0x0B, ebiten.KeyV: 0x0F,
+}
+
+// Update updates the key state and runs a frame. It ends the game when the
+// program quits.
+func (g *EbitenGame) Update() error {
+	m := g.KeyMap
+	if m == nil {
+		m = ebitenKeyMap
+	}
+	for k, key := range m {
+		if ebiten.IsKeyPressed(k) {
+			g.CPU.PressKey(key)
+		} else {
+			g.CPU.ReleaseKey(key)
+		}
+	}
+
+	if err := g.CPU.RunFrame(); err != nil {
+		if errors.Is(err, ErrQuit) {
+			return ebiten.Termination
+		}
+		return err
+	}
+	return nil
+}
+
+// Draw draws the framebuffer to screen, which Layout sizes to match it.
+func (g *EbitenGame) Draw(screen *ebiten.Image) {
+	g.img = g.CPU.Graphics.Image(g.img, g.OnColor, g.OffColor)
+	if screen.Bounds().Size() != g.img.Bounds().Size() {
+		// The resolution changed since Layout; the next frame catches up.
+		return
+	}
+	screen.WritePixels(g.img.Pix)
+}
+
+// Layout returns the resolution of the framebuffer; Ebiten scales it to
+// the window.
+func (g *EbitenGame) Layout(_, _ int) (int, int) {
+	return g.CPU.Graphics.Width(), g.CPU.Graphics.Height()
+}
@@ -0,0 +1,59 @@
+package chip8
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden screens in testdata")
+
+// goldenROMs are the ROMs in testdata with a golden screen. Each ROM is
+// run from testdata/<name>.ch8 for the given number of cycles, with its
+// profile in DefaultQuirkDB applied, and the screen is compared with
+// testdata/<name>.golden, a dump of Graphics.String. To add a ROM, drop it
+// in testdata, add it here and run the tests with -update to write its
+// golden screen, then check the screen by eye before committing it.
+var goldenROMs = []struct {
+	name   string
+	cycles int
+}{
+	// opcodes.ch8 checks FX33, 5XY0 and CXNN, and draws the digits
+	// "2 3 4 0 1" if they all work. See testdata/README.md.
+	{"opcodes", 100},
+	// vipquirks.ch8 needs the COSMAC VIP shift and load/store quirks from
+	// its profile, and draws "3 7" if they are applied.
+	{"vipquirks", 100},
+}
+
+func TestGoldenROMs(t *testing.T) {
+	for _, tc := range goldenROMs {
+		t.Run(tc.name, func(t *testing.T) {
+			rom, err := os.ReadFile(filepath.Join("testdata", tc.name+".ch8"))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			cpu := NewCPU(nil)
+			cpu.Graphics.Display = NullDisplay
+			cpu.ApplyProfile(ROMHash(rom))
+			_, err = cpu.LoadBytes(rom)
+			assert.NoError(t, err)
+			assert.NoError(t, cpu.RunN(tc.cycles))
+
+			golden := filepath.Join("testdata", tc.name+".golden")
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, []byte(cpu.Graphics.String()), 0644))
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if assert.NoError(t, err) {
+				assert.Equal(t, string(want), cpu.Graphics.String())
+			}
+		})
+	}
+}
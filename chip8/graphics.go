@@ -1,10 +1,27 @@
 package chip8
 
-import "github.com/nsf/termbox-go"
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/bits"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
 
 const (
 	GraphicsWidth  = 64 // Pixels
 	GraphicsHeight = 32 // Pixels
+
+	// MaxGraphicsWidth and MaxGraphicsHeight bound the resolutions that
+	// SetResolution accepts; they are the MegaChip resolution.
+	MaxGraphicsWidth  = 256 // Pixels
+	MaxGraphicsHeight = 192 // Pixels
 )
 
 type Display interface {
@@ -16,55 +33,213 @@ type DisplayFunc func(*Graphics) error
 func (f DisplayFunc) Render(g *Graphics) error {
 	return f(g)
 }
+
 var NullDisplay = DisplayFunc(func(*Graphics) error {
 	return nil
 })
+
+// ResolutionAware is implemented by displays that want to know when the
+// resolution changes, e.g. to resize a window. The CPU calls SetResolution
+// when a program switches resolution, such as with 00FE and 00FF.
+type ResolutionAware interface {
+	SetResolution(width, height int)
+}
+
+// VSyncer is implemented by displays with a real refresh. The CPU calls
+// WaitForVSync before drawing, so frames are only drawn between refreshes.
+type VSyncer interface {
+	WaitForVSync()
+}
+
 type Graphics struct {
+	// Pixels is the first plane as it was before the framebuffer became a
+	// bitset: one byte per pixel, 1 if it is on and 0 if not, addressed row
+	// by row. It is kept up to date while the resolution is GraphicsWidth x
+	// GraphicsHeight, and is all zero at other resolutions. Writes to it
+	// don't change the framebuffer.
+	//
+	// Deprecated: Use GetPixel or EachPixel.
 	Pixels [GraphicsWidth * GraphicsHeight]byte
+
+	// pixels is the framebuffer as a bitset, one bit per pixel, addressed
+	// row by row at the current resolution.
+	pixels [MaxGraphicsWidth * MaxGraphicsHeight / 64]uint64
+
+	// pixels2 is the second XO-CHIP plane, laid out like pixels, which is
+	// the first. Displays draw a pixel that is on in either plane as on.
+	pixels2 [MaxGraphicsWidth * MaxGraphicsHeight / 64]uint64
+
+	// planeMask selects the planes Set draws to, bit 0 for the first plane
+	// and bit 1 for the second. Zero means the first plane, as it is until
+	// SetPlanes is called; planesSelected marks an explicit selection. See
+	// SetPlanes.
+	planeMask byte
+
+	// Scale is a hint to displays that draw to pixels, such as images or
+	// windows, of how many output pixels square to draw each pixel as.
+	// Zero means 1. Displays can honor it with ScaledEachPixel.
+	Scale int
+
+	// width and height are the current resolution. Zero means the default
+	// GraphicsWidth x GraphicsHeight.
+	width, height int
+
+	// colors is the color attribute plane, one byte per 8x1 zone addressed
+	// row by row, holding the zone's color plus one, or 0 for
+	// DefaultColor. background is the background color. See SetColor.
+	colors     [MaxGraphicsWidth / 8 * MaxGraphicsHeight]byte
+	background byte
+
+	// changes counts the changes made to the framebuffer, so the rewind
+	// history can tell whether it needs a new copy of it.
+	changes uint64
+
 	Display
 }
 
-func (g *Graphics) WriteSprite(sprite []byte, x, y byte) (collision bool) {
-	n := len(sprite)
+// spriteRows maps every possible byte of sprite data to the pixels it turns
+// on in bitset order, leftmost pixel in bit 0, so WriteSprite can flip a
+// whole row of the bitset at once instead of masking bit by bit.
+var spriteRows = func() (rows [256]uint64) {
+	for b := range rows {
+		rows[b] = uint64(bits.Reverse8(uint8(b)))
+	}
+	return
+}()
 
-	for yl := 0; yl < n; yl++ {
-		// A row of sprite data.
-		r := sprite[yl]
+func (g *Graphics) WriteSprite(sprite []byte, x, y byte) (collision bool) {
+	return g.writeSprite(sprite, x, y, false, false, nil)
+}
 
-		for xl := 0; xl < 8; xl++ {
-			// This represents a mask for the bit that we
-			// care about for this coordinate.
-			i := 0x80 >> byte(xl)
+// WriteSpriteClipped is like WriteSprite, but the parts of the sprite past
+// the right edge are clipped if clipX is set, and the parts past the bottom
+// edge if clipY is set, instead of wrapping around. The position itself
+// always wraps.
+func (g *Graphics) WriteSpriteClipped(sprite []byte, x, y byte, clipX, clipY bool) (collision bool) {
+	return g.writeSprite(sprite, x, y, clipX, clipY, nil)
+}
 
-			// Whether the bit is set or not.
-			on := (r & byte(i)) == byte(i)
+// WriteSpriteTracked is like WriteSprite, but also returns the addresses
+// (x + y*Width()) of the pixels the sprite flipped, in drawing order.
+func (g *Graphics) WriteSpriteTracked(sprite []byte, x, y byte) (collision bool, touched []int) {
+	touched = []int{}
+	collision = g.writeSprite(sprite, x, y, false, false, &touched)
+	return
+}
 
-			// The X position for this pixel
-			xp := uint16(x) + uint16(xl)
-			if xp >= GraphicsWidth {
-				xp = xp - GraphicsWidth
+// writeSprite draws sprite at (x, y), clipping or wrapping at the edges,
+// and appends the address of each pixel it flips to touched if touched
+// isn't nil. Unlike Set, it checks the bounds and the planes once per row
+// and flips the row's pixels a word at a time.
+func (g *Graphics) writeSprite(sprite []byte, x, y byte, clipX, clipY bool, touched *[]int) (collision bool) {
+	w, h := g.Width(), g.Height()
+	x0, y0 := int(x)%w, int(y)%h
+	planes := g.Planes()
+	mirror := w == GraphicsWidth && h == GraphicsHeight
+	g.changes++
+
+	// The row is split into the pixels left of the right edge, and those
+	// that wrap around to the left edge. Pixels that would wrap a second
+	// time, on screens narrower than a sprite, are dropped.
+	n1 := min(8, w-x0)
+	n2 := 0
+	if !clipX {
+		n2 = min(8-n1, w)
+	}
+	mask1 := uint64(1)<<uint(n1) - 1
+	mask2 := uint64(1)<<uint(n2) - 1
+
+	for yl := 0; yl < len(sprite); yl++ {
+		// The Y position for this row
+		yp := y0 + yl
+		if yp >= h {
+			if clipY {
+				break
 			}
-
-			// The Y position for this pixel
-			yp := uint16(y) + uint16(yl)
-			if yp >= GraphicsHeight {
-				yp = yp - GraphicsHeight
+			yp -= h
+			if yp >= h {
+				continue
 			}
+		}
 
-			if g.Set(xp, yp, on) {
-				collision = true
-			}
+		r := spriteRows[sprite[yl]]
+		if r == 0 {
+			continue
+		}
+		a1, bits1 := x0+yp*w, r&mask1
+		a2, bits2 := yp*w, r>>uint(n1)&mask2
+
+		if planes&0x01 != 0 {
+			collision = flipBits(&g.pixels, a1, bits1) || collision
+			collision = flipBits(&g.pixels, a2, bits2) || collision
+		}
+		if planes&0x02 != 0 {
+			collision = flipBits(&g.pixels2, a1, bits1) || collision
+			collision = flipBits(&g.pixels2, a2, bits2) || collision
+		}
+		if mirror && planes&0x01 != 0 {
+			g.mirrorBits(a1, bits1)
+			g.mirrorBits(a2, bits2)
+		}
+		if touched != nil {
+			appendBits(touched, a1, bits1)
+			appendBits(touched, a2, bits2)
 		}
 	}
 
 	return
 }
 
-// Clear clears the display.
+// flipBits flips the pixels of plane from addr a on for which row has a
+// bit set, bit 0 for a itself, and reports whether any of them was on.
+// row is at most 8 pixels wide, so it spans at most two words.
+func flipBits(plane *[len(Graphics{}.pixels)]uint64, a int, row uint64) (collision bool) {
+	if row == 0 {
+		return false
+	}
+	i, s := a/64, uint(a%64)
+	lo := row << s
+	collision = plane[i]&lo != 0
+	plane[i] ^= lo
+	if s > 56 {
+		if hi := row >> (64 - s); hi != 0 {
+			collision = collision || plane[i+1]&hi != 0
+			plane[i+1] ^= hi
+		}
+	}
+	return
+}
+
+// mirrorBits flips the pixels of Pixels from addr a on for which row has a
+// bit set, as writeSprite flipped them in the first plane.
+func (g *Graphics) mirrorBits(a int, row uint64) {
+	for ; row != 0; row &= row - 1 {
+		g.Pixels[a+bits.TrailingZeros64(row)] ^= 1
+	}
+}
+
+// appendBits appends the addresses from a on for which row has a bit set to
+// touched.
+func appendBits(touched *[]int, a int, row uint64) {
+	for ; row != 0; row &= row - 1 {
+		*touched = append(*touched, a+bits.TrailingZeros64(row))
+	}
+}
+
+// Clear clears the display, in every plane.
 func (g *Graphics) Clear() {
-	g.EachPixel(func(_, _ uint16, addr int) {
-		g.Pixels[addr] = 0
-	})
+	g.clearPixels(g.Width() * g.Height())
+}
+
+// clearPixels turns off the first n pixels in every plane. The words past
+// the current resolution are already zero, so Clear only needs to clear
+// the pixels on the screen.
+func (g *Graphics) clearPixels(n int) {
+	words := (n + 63) / 64
+	clear(g.pixels[:words])
+	clear(g.pixels2[:words])
+	clear(g.Pixels[:])
+	g.changes++
 }
 
 // Draw draws the graphics array to the Display.
@@ -74,33 +249,477 @@ func (g *Graphics) Draw() error {
 
 // EachPixel yields each pixel in the graphics array to fn.
 func (g *Graphics) EachPixel(fn func(x, y uint16, addr int)) {
-	for y := 0; y < GraphicsHeight-1; y++ {
-		for x := 0; x < GraphicsWidth-1; x++ {
-			a := y*GraphicsWidth + x
+	for y := 0; y < g.Height(); y++ {
+		for x := 0; x < g.Width(); x++ {
+			a := y*g.Width() + x
 			fn(uint16(x), uint16(y), a)
 		}
 	}
 }
 
-// Set turns the pixel at the given coordinates on or off. If there's a
-// collision, it returns true.
-func (g *Graphics) Set(x, y uint16, on bool) (collision bool) {
-	a := x + y*GraphicsWidth
+// Width returns the width of the framebuffer in pixels.
+func (g *Graphics) Width() int {
+	if g.width == 0 {
+		return GraphicsWidth
+	}
+	return g.width
+}
 
-	if g.Pixels[a] == 0x01 {
-		collision = true
+// Height returns the height of the framebuffer in pixels.
+func (g *Graphics) Height() int {
+	if g.height == 0 {
+		return GraphicsHeight
 	}
+	return g.height
+}
+
+// SetResolution changes the resolution of the framebuffer and clears it,
+// along with its colors. The resolution is clamped to MaxGraphicsWidth x
+// MaxGraphicsHeight.
+func (g *Graphics) SetResolution(width, height int) {
+	pixels := g.Width() * g.Height()
+	zones := (g.Width() + 7) / 8 * g.Height()
+	g.width = min(max(width, 1), MaxGraphicsWidth)
+	g.height = min(max(height, 1), MaxGraphicsHeight)
+	// Clear whichever of the old and new screens is bigger, so nothing is
+	// left over past the new one.
+	clear(g.colors[:max(zones, (g.Width()+7)/8*g.Height())])
+	g.clearPixels(max(pixels, g.Width()*g.Height()))
+}
 
-	var v byte
-	if on {
-		v = 0x01
+// String returns the framebuffer as text, one line per row, with '#' for
+// pixels that are on and '.' for pixels that are off.
+func (g *Graphics) String() string {
+	var b strings.Builder
+	b.Grow((g.Width() + 1) * g.Height())
+	g.EachPixel(func(x, _ uint16, addr int) {
+		if g.lit(addr) {
+			b.WriteByte('#')
+		} else {
+			b.WriteByte('.')
+		}
+		if int(x) == g.Width()-1 {
+			b.WriteByte('\n')
+		}
+	})
+	return b.String()
+}
+
+// RegionString is like String, but only for the w x h pixel region with its
+// top left corner at (x, y). The region is clipped to the screen, and if
+// none of it is on the screen the result is empty.
+func (g *Graphics) RegionString(x, y, w, h int) string {
+	x0, y0 := max(x, 0), max(y, 0)
+	x1, y1 := min(x+w, g.Width()), min(y+h, g.Height())
+	if x0 >= x1 || y0 >= y1 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.Grow((x1 - x0 + 1) * (y1 - y0))
+	for yp := y0; yp < y1; yp++ {
+		for xp := x0; xp < x1; xp++ {
+			if g.lit(xp + yp*g.Width()) {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
 	}
+	return b.String()
+}
 
-	g.Pixels[a] = g.Pixels[a] ^ v
+// CountOnPixels returns the number of pixels that are on, in any plane.
+func (g *Graphics) CountOnPixels() int {
+	n := 0
+	g.EachPixel(func(_, _ uint16, addr int) {
+		if g.lit(addr) {
+			n++
+		}
+	})
+	return n
+}
 
+// BoundingBox returns the smallest rectangle containing every pixel that is
+// on in any plane, from (minX, minY) to (maxX, maxY) inclusive. If no pixel
+// is on, empty is true and the coordinates are zero.
+func (g *Graphics) BoundingBox() (minX, minY, maxX, maxY int, empty bool) {
+	empty = true
+	g.EachPixel(func(x, y uint16, addr int) {
+		if !g.lit(addr) {
+			return
+		}
+		if empty {
+			minX, minY, maxX, maxY = int(x), int(y), int(x), int(y)
+			empty = false
+			return
+		}
+		minX, maxX = min(minX, int(x)), max(maxX, int(x))
+		minY, maxY = min(minY, int(y)), max(maxY, int(y))
+	})
 	return
 }
 
+// PackedBytes returns the framebuffer packed 8 pixels per byte, row by row,
+// with the leftmost pixel in the most significant bit, and a pixel on if it
+// is on in any plane. Rows are padded to a whole number of bytes.
+func (g *Graphics) PackedBytes() []byte {
+	return g.pack(g.lit)
+}
+
+// pack packs the pixels for which on is true like PackedBytes.
+func (g *Graphics) pack(on func(addr int) bool) []byte {
+	stride := (g.Width() + 7) / 8
+	b := make([]byte, stride*g.Height())
+	g.EachPixel(func(x, y uint16, addr int) {
+		if on(addr) {
+			b[int(y)*stride+int(x)/8] |= 0x80 >> (x % 8)
+		}
+	})
+	return b
+}
+
+// unpack sets the pixels of plane from b, packed like PackedBytes.
+func (g *Graphics) unpack(plane *[len(Graphics{}.pixels)]uint64, b []byte) {
+	stride := (g.Width() + 7) / 8
+	g.EachPixel(func(x, y uint16, addr int) {
+		if b[int(y)*stride+int(x)/8]&(0x80>>(x%8)) != 0 {
+			plane[addr/64] |= 1 << uint(addr%64)
+		}
+	})
+}
+
+// graphicsVersion is the version of the binary encoding written by
+// MarshalBinary, after a 0xFF marker. The first version had no marker: it
+// started with the width, whose high byte is never 0xFF.
+const graphicsVersion = 2
+
+// MarshalBinary encodes the framebuffer as 0xFF and graphicsVersion, the
+// width and height, each as a big-endian uint16, the selected planes, the
+// background color, each plane packed as by PackedBytes and the color of
+// each 8x1 zone, row by row.
+func (g *Graphics) MarshalBinary() ([]byte, error) {
+	zones := (g.Width() + 7) / 8 * g.Height()
+	b := make([]byte, 8, 8+3*zones)
+	b[0], b[1] = 0xFF, graphicsVersion
+	binary.BigEndian.PutUint16(b[2:], uint16(g.Width()))
+	binary.BigEndian.PutUint16(b[4:], uint16(g.Height()))
+	b[6], b[7] = g.planeMask, g.background
+	b = append(b, g.pack(g.pixel)...)
+	b = append(b, g.pack(g.pixel2)...)
+	return append(b, g.colors[:zones]...), nil
+}
+
+// UnmarshalBinary decodes a framebuffer encoded by MarshalBinary, changing
+// the resolution to the one it was encoded at. It also decodes the first
+// version of the encoding, which only has the first plane.
+func (g *Graphics) UnmarshalBinary(data []byte) error {
+	if len(data) > 0 && data[0] != 0xFF {
+		return g.unmarshalV1(data)
+	}
+	if len(data) < 8 {
+		return fmt.Errorf("chip8: graphics data is %d bytes, too short for a header", len(data))
+	}
+	if data[1] != graphicsVersion {
+		return fmt.Errorf("chip8: graphics data has unsupported version %d", data[1])
+	}
+	w := int(binary.BigEndian.Uint16(data[2:]))
+	h := int(binary.BigEndian.Uint16(data[4:]))
+	if w < 1 || w > MaxGraphicsWidth || h < 1 || h > MaxGraphicsHeight {
+		return fmt.Errorf("chip8: graphics data has unsupported resolution %dx%d", w, h)
+	}
+	zones := (w + 7) / 8 * h
+	if len(data)-8 != 3*zones {
+		return fmt.Errorf("chip8: graphics data is %d bytes, want %d for %dx%d", len(data)-8, 3*zones, w, h)
+	}
+	if data[6]&^(planesSelected|0x03) != 0 {
+		return fmt.Errorf("chip8: graphics data has unsupported planes 0x%02X", data[6])
+	}
+	if data[7] >= byte(len(backgroundColors)) {
+		return fmt.Errorf("chip8: graphics data has unsupported background %d", data[7])
+	}
+	// Zone colors are stored plus one, with 0 for DefaultColor.
+	for i, c := range data[8+2*zones:] {
+		if int(c) > len(ColorPalette) {
+			return fmt.Errorf("chip8: graphics data has unsupported color %d in zone %d", c, i)
+		}
+	}
+
+	g.SetResolution(w, h)
+	g.planeMask, g.background = data[6], data[7]
+	data = data[8:]
+	g.unpack(&g.pixels, data[:zones])
+	g.unpack(&g.pixels2, data[zones:2*zones])
+	copy(g.colors[:], data[2*zones:])
+	g.mirrorAll()
+	return nil
+}
+
+// unmarshalV1 decodes the first version of the encoding: the width and
+// height, each as a big-endian uint16, followed by the first plane packed
+// as by PackedBytes.
+func (g *Graphics) unmarshalV1(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("chip8: graphics data is %d bytes, too short for a header", len(data))
+	}
+	w := int(binary.BigEndian.Uint16(data[0:]))
+	h := int(binary.BigEndian.Uint16(data[2:]))
+	if w < 1 || w > MaxGraphicsWidth || h < 1 || h > MaxGraphicsHeight {
+		return fmt.Errorf("chip8: graphics data has unsupported resolution %dx%d", w, h)
+	}
+	stride := (w + 7) / 8
+	if len(data)-4 != stride*h {
+		return fmt.Errorf("chip8: graphics data is %d bytes, want %d for %dx%d", len(data)-4, stride*h, w, h)
+	}
+
+	g.SetResolution(w, h)
+	g.unpack(&g.pixels, data[4:])
+	g.mirrorAll()
+	return nil
+}
+
+// FlipHorizontal mirrors the framebuffer left to right, in every plane,
+// along with its colors.
+func (g *Graphics) FlipHorizontal() {
+	g.changes++
+	w, h := g.Width(), g.Height()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w/2; x++ {
+			g.swap(x+y*w, w-1-x+y*w)
+		}
+	}
+	stride := (w + 7) / 8
+	for y := 0; y < h; y++ {
+		row := g.colors[y*stride : (y+1)*stride]
+		for i, j := 0, len(row)-1; i < j; i, j = i+1, j-1 {
+			row[i], row[j] = row[j], row[i]
+		}
+	}
+}
+
+// FlipVertical mirrors the framebuffer top to bottom, in every plane, along
+// with its colors.
+func (g *Graphics) FlipVertical() {
+	g.changes++
+	w, h := g.Width(), g.Height()
+	for y := 0; y < h/2; y++ {
+		for x := 0; x < w; x++ {
+			g.swap(x+y*w, x+(h-1-y)*w)
+		}
+	}
+	stride := (w + 7) / 8
+	for y := 0; y < h/2; y++ {
+		a := g.colors[y*stride : (y+1)*stride]
+		b := g.colors[(h-1-y)*stride : (h-y)*stride]
+		for i := range a {
+			a[i], b[i] = b[i], a[i]
+		}
+	}
+}
+
+// swap exchanges the pixels at addresses a and b, in every plane.
+func (g *Graphics) swap(a, b int) {
+	for _, plane := range []*[len(g.pixels)]uint64{&g.pixels, &g.pixels2} {
+		pa := plane[a/64]&(1<<uint(a%64)) != 0
+		pb := plane[b/64]&(1<<uint(b%64)) != 0
+		if pa != pb {
+			plane[a/64] ^= 1 << uint(a%64)
+			plane[b/64] ^= 1 << uint(b%64)
+		}
+	}
+	g.mirror(a)
+	g.mirror(b)
+}
+
+// WritePBM writes the framebuffer to w as a plain (P1) portable bitmap.
+func (g *Graphics) WritePBM(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P1\n%d %d\n", g.Width(), g.Height())
+	g.EachPixel(func(x, _ uint16, addr int) {
+		if x > 0 {
+			bw.WriteByte(' ')
+		}
+		b := byte('0')
+		if g.lit(addr) {
+			b = '1'
+		}
+		bw.WriteByte(b)
+		if int(x) == g.Width()-1 {
+			bw.WriteByte('\n')
+		}
+	})
+	return bw.Flush()
+}
+
+// RenderTo paints the framebuffer into img, each pixel as a scale x scale
+// block of onColor or offColor, starting at the top left of img's bounds.
+// Anything that doesn't fit in img is clipped.
+func (g *Graphics) RenderTo(img *image.RGBA, onColor, offColor color.RGBA, scale int) {
+	b := img.Bounds()
+	g.ScaledEachPixel(scale, func(x, y int, on bool) {
+		p := image.Pt(x, y).Add(b.Min)
+		if !p.In(b) {
+			return
+		}
+		c := offColor
+		if on {
+			c = onColor
+		}
+		img.SetRGBA(p.X, p.Y, c)
+	})
+}
+
+// SnapshotPNG writes the framebuffer to w as a PNG, white on black, with
+// each pixel scale x scale pixels in size. A scale below 1 is treated as 1.
+func (g *Graphics) SnapshotPNG(w io.Writer, scale int) error {
+	scale = max(scale, 1)
+	img := image.NewRGBA(image.Rect(0, 0, g.Width()*scale, g.Height()*scale))
+	g.RenderTo(img, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, color.RGBA{0x00, 0x00, 0x00, 0xFF}, scale)
+	return png.Encode(w, img)
+}
+
+// Image returns the framebuffer as an image with one image pixel per pixel,
+// in onColor and offColor. buf is drawn into and returned if it has the
+// framebuffer's size, so front-ends can reuse one image from frame to
+// frame; otherwise a new image is allocated.
+func (g *Graphics) Image(buf *image.RGBA, onColor, offColor color.RGBA) *image.RGBA {
+	r := image.Rect(0, 0, g.Width(), g.Height())
+	if buf == nil || buf.Bounds() != r {
+		buf = image.NewRGBA(r)
+	}
+	g.RenderTo(buf, onColor, offColor, 1)
+	return buf
+}
+
+// ScaledEachPixel calls fn for every output pixel of the framebuffer scaled
+// up scale times, row by row, with whether the pixel it belongs to is on in
+// any plane.
+// A scale below 1 is treated as 1. Pass g.Scale to use the scale hint.
+func (g *Graphics) ScaledEachPixel(scale int, fn func(x, y int, on bool)) {
+	if scale < 1 {
+		scale = 1
+	}
+	w, h := g.Width(), g.Height()
+	for y := 0; y < h*scale; y++ {
+		for x := 0; x < w*scale; x++ {
+			fn(x, y, g.lit(y/scale*w+x/scale))
+		}
+	}
+}
+
+// Set flips the pixel at the given coordinates in each selected plane if
+// on is true, and leaves it alone otherwise. It returns true if a pixel
+// that was on was flipped off in any of the planes, which is a collision.
+// Coordinates off the screen are ignored. Set checks the bounds and planes
+// for every pixel; the sprite writers do so once per row instead.
+func (g *Graphics) Set(x, y uint16, on bool) (collision bool) {
+	a, ok := g.addr(x, y)
+	if !on || !ok {
+		return false
+	}
+	g.changes++
+
+	bit := uint64(1) << uint(a%64)
+	planes := g.Planes()
+	for i, plane := range []*[len(g.pixels)]uint64{&g.pixels, &g.pixels2} {
+		if planes&(1<<uint(i)) == 0 {
+			continue
+		}
+		if plane[a/64]&bit != 0 {
+			collision = true
+		}
+		plane[a/64] ^= bit
+	}
+	g.mirror(a)
+	return
+}
+
+// planesSelected is set in planeMask once SetPlanes has been called, so an
+// empty selection can be told apart from the default.
+const planesSelected = 0x80
+
+// SetPlanes selects the XO-CHIP planes that Set, and so the sprite
+// writers, draw to: bit 0 for the first plane and bit 1 for the second.
+// With both selected a pixel is flipped in both, and a collision in either
+// counts. With neither selected nothing is drawn.
+func (g *Graphics) SetPlanes(mask byte) {
+	g.planeMask = mask&0x03 | planesSelected
+	g.changes++
+}
+
+// Planes returns the selected planes as set by SetPlanes. Until SetPlanes
+// is called, the first plane is selected.
+func (g *Graphics) Planes() byte {
+	if g.planeMask == 0 {
+		return 0x01
+	}
+	return g.planeMask &^ planesSelected
+}
+
+// GetPlanePixel reports whether the pixel at the given coordinates is on in
+// the plane, 0 for the first and 1 for the second. Pixels off the screen,
+// or in planes that don't exist, are off.
+func (g *Graphics) GetPlanePixel(plane int, x, y uint16) bool {
+	a, ok := g.addr(x, y)
+	switch {
+	case !ok:
+		return false
+	case plane == 0:
+		return g.pixel(a)
+	case plane == 1:
+		return g.pixel2(a)
+	default:
+		return false
+	}
+}
+
+// GetPixel reports whether the pixel at the given coordinates is on.
+// Pixels off the screen are off.
+func (g *Graphics) GetPixel(x, y uint16) bool {
+	a, ok := g.addr(x, y)
+	return ok && g.pixel(a)
+}
+
+// addr returns the address of the pixel at the given coordinates, and false
+// if they are off the screen at the current resolution.
+func (g *Graphics) addr(x, y uint16) (int, bool) {
+	if int(x) >= g.Width() || int(y) >= g.Height() {
+		return 0, false
+	}
+	return int(x) + int(y)*g.Width(), true
+}
+
+func (g *Graphics) pixel(addr int) bool {
+	return g.pixels[addr/64]&(1<<uint(addr%64)) != 0
+}
+
+// mirror copies the pixel at addr in the first plane to Pixels, at the
+// resolution Pixels is kept up to date at.
+func (g *Graphics) mirror(addr int) {
+	if g.Width() != GraphicsWidth || g.Height() != GraphicsHeight {
+		return
+	}
+	g.Pixels[addr] = byte(g.pixels[addr/64] >> uint(addr%64) & 1)
+}
+
+// mirrorAll copies the first plane to Pixels.
+func (g *Graphics) mirrorAll() {
+	for a := range g.Pixels {
+		g.mirror(a)
+	}
+}
+
+func (g *Graphics) pixel2(addr int) bool {
+	return g.pixels2[addr/64]&(1<<uint(addr%64)) != 0
+}
+
+// lit reports whether the pixel at addr is on in any plane, as displays
+// show it.
+func (g *Graphics) lit(addr int) bool {
+	return (g.pixels[addr/64]|g.pixels2[addr/64])&(1<<uint(addr%64)) != 0
+}
+
 func (g *Graphics) display() Display {
 	if g.Display == nil {
 		return DefaultDisplay
@@ -129,35 +748,122 @@ func termboxInit(bg termbox.Attribute) error {
 // the graphics array to the terminal.
 type TermboxDisplay struct {
 	fg, bg termbox.Attribute
+
+	// OnRune and OffRune are the characters drawn for lit and unlit pixels,
+	// for terminals or fonts where the defaults, '█' and ' ', don't look
+	// right. Zero means the default. Cells already drawn are only redrawn
+	// when their pixel changes, so set them before the first Render.
+	OnRune, OffRune rune
+
+	// prev is the framebuffer as last rendered, one bool per pixel, so only
+	// the cells that changed are written. It is nil until the first frame
+	// and after the resolution changes.
+	prev          []bool
+	width, height int
+
+	// setCell and flush are termbox.SetCell and termbox.Flush, unless
+	// replaced by tests.
+	setCell func(x, y int, ch rune, fg, bg termbox.Attribute)
+	flush   func() error
 }
 
 // NewTermboxDisplay returns a new TermboxDisplay instance.
 func NewTermboxDisplay(fg, bg termbox.Attribute) (*TermboxDisplay, error) {
+	return NewTermboxDisplayWithRunes(fg, bg, 0, 0)
+}
+
+// NewTermboxDisplayWithRunes returns a new TermboxDisplay drawing lit pixels
+// as on and unlit pixels as off. Zero runes use the defaults.
+func NewTermboxDisplayWithRunes(fg, bg termbox.Attribute, on, off rune) (*TermboxDisplay, error) {
 	return &TermboxDisplay{
-		fg: fg,
-		bg: bg,
+		fg:      fg,
+		bg:      bg,
+		OnRune:  on,
+		OffRune: off,
 	}, termboxInit(bg)
 }
 
-// Render renders the graphics array to the terminal using Termbox.
+// Render renders the graphics array to the terminal using Termbox. Only the
+// cells that changed since the last frame are written.
 func (d *TermboxDisplay) Render(g *Graphics) error {
-	g.EachPixel(func(x, y uint16, addr int) {
-		v := ' '
+	if d.prev == nil || d.width != g.Width() || d.height != g.Height() {
+		if d.prev != nil {
+			d.blankOutside(g.Width(), g.Height())
+		}
+		d.width, d.height = g.Width(), g.Height()
+		d.prev = nil
+	}
+	full := d.prev == nil
+	if full {
+		d.prev = make([]bool, d.width*d.height)
+	}
 
-		if g.Pixels[addr] == 0x01 {
-			v = '█'
+	g.EachPixel(func(x, y uint16, addr int) {
+		on := g.lit(addr)
+		if !full && on == d.prev[addr] {
+			return
 		}
+		d.prev[addr] = on
 
-		termbox.SetCell(
-			int(x),
-			int(y),
-			v,
-			d.fg,
-			d.bg,
-		)
+		v := d.OffRune
+		if v == 0 {
+			v = ' '
+		}
+		if on {
+			v = d.OnRune
+			if v == 0 {
+				v = '█'
+			}
+		}
+		d.cell(int(x), int(y), v)
 	})
 
-	return termbox.Flush()
+	return d.flushCells()
+}
+
+// blankOutside blanks the cells of the last frame that fall outside a new
+// width x height screen, which a smaller resolution would leave behind.
+func (d *TermboxDisplay) blankOutside(width, height int) {
+	for y := 0; y < d.height; y++ {
+		for x := 0; x < d.width; x++ {
+			if x >= width || y >= height {
+				d.cell(x, y, ' ')
+			}
+		}
+	}
+}
+
+// RenderText renders text below the graphics array, one line per row, at
+// the resolution it was last rendered at.
+func (d *TermboxDisplay) RenderText(text string) error {
+	top := d.height
+	if top == 0 {
+		top = GraphicsHeight
+	}
+	for i, line := range strings.Split(text, "\n") {
+		x := 0
+		for _, r := range line {
+			d.cell(x, top+1+i, r)
+			x++
+		}
+	}
+
+	return d.flushCells()
+}
+
+func (d *TermboxDisplay) cell(x, y int, ch rune) {
+	if d.setCell == nil {
+		termbox.SetCell(x, y, ch, d.fg, d.bg)
+		return
+	}
+	d.setCell(x, y, ch, d.fg, d.bg)
+}
+
+func (d *TermboxDisplay) flushCells() error {
+	if d.flush == nil {
+		return termbox.Flush()
+	}
+	return d.flush()
 }
 
 func (d *TermboxDisplay) Close() {
@@ -0,0 +1,654 @@
+package chip8
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphics_WritePBM(t *testing.T) {
+	var g Graphics
+	g.WriteSprite([]byte{0xA0, 0x40}, 0, 0)
+
+	var buf bytes.Buffer
+	if err := g.WritePBM(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "P1", lines[0])
+	assert.Equal(t, "64 32", lines[1])
+	assert.Equal(t, "1 0 1 0"+strings.Repeat(" 0", 60), lines[2])
+	assert.Equal(t, "0 1 0 0"+strings.Repeat(" 0", 60), lines[3])
+	assert.Equal(t, strings.TrimPrefix(strings.Repeat(" 0", 64), " "), lines[33])
+	assert.Len(t, lines, 2+32+1)
+}
+
+// writeSpriteBitwise is the straightforward implementation of WriteSprite,
+// masking bit by bit and drawing each pixel with Set. It is kept as a
+// reference for the decoded sprite table, which WriteSprite must match
+// and beat.
+func writeSpriteBitwise(g *Graphics, sprite []byte, x, y byte) (collision bool) {
+	w, h := g.Width(), g.Height()
+	for yl, r := range sprite {
+		for xl := 0; xl < 8; xl++ {
+			i := byte(0x80 >> byte(xl))
+			// Positions wrap once; what would wrap again is off the screen.
+			xp, yp := int(x)%w+xl, int(y)%h+yl
+			if xp >= w {
+				xp -= w
+			}
+			if yp >= h {
+				yp -= h
+			}
+			if g.Set(uint16(xp), uint16(yp), r&i == i) {
+				collision = true
+			}
+		}
+	}
+	return
+}
+
+func TestGraphics_WriteSprite_matchesBitwise(t *testing.T) {
+	var sprite []byte
+	for b := 0; b < 256; b += 17 {
+		sprite = append(sprite, byte(b))
+	}
+
+	// Widths that aren't a multiple of 64 put rows across two words, and
+	// screens narrower or shorter than a sprite drop what wraps twice.
+	resolutions := [][2]int{{GraphicsWidth, GraphicsHeight}, {61, 7}, {100, 13}, {5, 3}, {1, 1}}
+	for _, res := range resolutions {
+		for _, planes := range []byte{0x01, 0x02, 0x03} {
+			for _, pos := range [][2]byte{{0, 0}, {10, 5}, {60, 30}, {99, 12}} {
+				var got, want Graphics
+				got.SetResolution(res[0], res[1])
+				want.SetResolution(res[0], res[1])
+				got.SetPlanes(planes)
+				want.SetPlanes(planes)
+				for i := 0; i < 2; i++ {
+					assert.Equal(t,
+						writeSpriteBitwise(&want, sprite, pos[0], pos[1]),
+						got.WriteSprite(sprite, pos[0], pos[1]),
+						"%v planes %d at %v", res, planes, pos,
+					)
+					assert.Equal(t, want.pixels, got.pixels, "%v planes %d at %v", res, planes, pos)
+					assert.Equal(t, want.pixels2, got.pixels2, "%v planes %d at %v", res, planes, pos)
+					assert.Equal(t, want.Pixels, got.Pixels, "%v planes %d at %v", res, planes, pos)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkWriteSprite(b *testing.B) {
+	var g Graphics
+	sprite := FONT[:15]
+	for i := 0; i < b.N; i++ {
+		g.WriteSprite(sprite, byte(i%GraphicsWidth), byte(i%GraphicsHeight))
+	}
+}
+
+func BenchmarkWriteSprite_bitwise(b *testing.B) {
+	var g Graphics
+	sprite := FONT[:15]
+	for i := 0; i < b.N; i++ {
+		writeSpriteBitwise(&g, sprite, byte(i%GraphicsWidth), byte(i%GraphicsHeight))
+	}
+}
+
+func TestGraphics_SetGetPixel(t *testing.T) {
+	var g Graphics
+	assert.False(t, g.Set(63, 31, true))
+	assert.False(t, g.Set(0, 1, true))
+	assert.True(t, g.GetPixel(63, 31))
+	assert.True(t, g.GetPixel(0, 1))
+	assert.False(t, g.GetPixel(62, 31))
+	assert.False(t, g.GetPixel(63, 0))
+
+	assert.True(t, g.Set(63, 31, true))
+	assert.False(t, g.GetPixel(63, 31))
+
+	g.Clear()
+	g.EachPixel(func(x, y uint16, _ int) {
+		assert.False(t, g.GetPixel(x, y))
+	})
+}
+
+func TestGraphics_SetGetPixel_bounds(t *testing.T) {
+	for _, res := range [][2]int{{GraphicsWidth, GraphicsHeight}, {MaxGraphicsWidth, MaxGraphicsHeight}} {
+		var g Graphics
+		g.SetResolution(res[0], res[1])
+		w, h := uint16(res[0]), uint16(res[1])
+
+		// The last pixel on the screen.
+		assert.False(t, g.Set(w-1, h-1, true))
+		assert.True(t, g.GetPixel(w-1, h-1))
+		assert.Equal(t, 1, g.CountOnPixels())
+
+		// Just past the right and bottom edges, nothing is drawn, rather
+		// than wrapping to the next row or panicking.
+		assert.NotPanics(t, func() {
+			assert.False(t, g.Set(w, h-1, true))
+			assert.False(t, g.Set(0, h, true))
+			assert.False(t, g.Set(w, h, true))
+			assert.False(t, g.Set(0xFFFF, 0xFFFF, true))
+		})
+		assert.False(t, g.GetPixel(w, 0))
+		assert.False(t, g.GetPixel(0, h))
+		assert.False(t, g.GetPixel(0xFFFF, 0xFFFF))
+		assert.Equal(t, 1, g.CountOnPixels())
+	}
+}
+
+func TestGraphics_SetPlanes(t *testing.T) {
+	var g Graphics
+	assert.Equal(t, byte(0x01), g.Planes())
+
+	// Only the second plane has the pixel on.
+	g.SetPlanes(0x02)
+	assert.False(t, g.Set(3, 4, true))
+	assert.False(t, g.GetPlanePixel(0, 3, 4))
+	assert.True(t, g.GetPlanePixel(1, 3, 4))
+
+	// Drawing to both collides in the second and turns on the first.
+	g.SetPlanes(0x03)
+	assert.True(t, g.WriteSprite([]byte{0x10}, 0, 4))
+	assert.True(t, g.GetPlanePixel(0, 3, 4))
+	assert.False(t, g.GetPlanePixel(1, 3, 4))
+
+	// No planes, nothing is drawn.
+	g.SetPlanes(0)
+	assert.Equal(t, byte(0), g.Planes())
+	assert.False(t, g.Set(3, 4, true))
+	assert.True(t, g.GetPlanePixel(0, 3, 4))
+
+	g.Clear()
+	assert.False(t, g.GetPlanePixel(0, 3, 4))
+	assert.False(t, g.GetPlanePixel(2, 3, 4))
+}
+
+func BenchmarkClear(b *testing.B) {
+	var g Graphics
+	for i := 0; i < b.N; i++ {
+		g.Clear()
+	}
+}
+
+func TestGraphics_RenderTo(t *testing.T) {
+	var g Graphics
+	g.WriteSprite([]byte{0x80}, 1, 2)
+
+	on := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	off := color.RGBA{0x00, 0x00, 0x00, 0xFF}
+	img := image.NewRGBA(image.Rect(0, 0, GraphicsWidth*2, GraphicsHeight*2))
+	g.RenderTo(img, on, off, 2)
+
+	assert.Equal(t, on, img.RGBAAt(2, 4))
+	assert.Equal(t, on, img.RGBAAt(3, 5))
+	assert.Equal(t, off, img.RGBAAt(1, 4))
+	assert.Equal(t, off, img.RGBAAt(4, 4))
+	assert.Equal(t, off, img.RGBAAt(127, 63))
+
+	// Images smaller than the framebuffer are clipped.
+	small := image.NewRGBA(image.Rect(0, 0, 2, 3))
+	g.RenderTo(small, on, off, 1)
+	assert.Equal(t, on, small.RGBAAt(1, 2))
+	assert.Equal(t, off, small.RGBAAt(0, 2))
+}
+
+func TestGraphics_Image(t *testing.T) {
+	var g Graphics
+	g.WriteSprite([]byte{0xC0}, 62, 31)
+
+	on := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	off := color.RGBA{0x00, 0x00, 0x00, 0xFF}
+	img := g.Image(nil, on, off)
+	assert.Equal(t, image.Rect(0, 0, GraphicsWidth, GraphicsHeight), img.Bounds())
+	assert.Equal(t, on, img.RGBAAt(62, 31))
+	assert.Equal(t, on, img.RGBAAt(63, 31))
+	assert.Equal(t, off, img.RGBAAt(61, 31))
+	assert.Equal(t, off, img.RGBAAt(0, 0))
+
+	// The image is reused while the resolution stays the same.
+	g.Clear()
+	g.Set(0, 0, true)
+	assert.Same(t, img, g.Image(img, on, off))
+	assert.Equal(t, on, img.RGBAAt(0, 0))
+	assert.Equal(t, off, img.RGBAAt(62, 31))
+
+	g.SetResolution(128, 64)
+	big := g.Image(img, on, off)
+	assert.NotSame(t, img, big)
+	assert.Equal(t, image.Rect(0, 0, 128, 64), big.Bounds())
+}
+
+func TestGraphics_SnapshotPNG(t *testing.T) {
+	var g Graphics
+	g.Set(3, 1, true)
+
+	var buf bytes.Buffer
+	assert.NoError(t, g.SnapshotPNG(&buf, 4))
+	img, err := png.Decode(&buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, image.Rect(0, 0, GraphicsWidth*4, GraphicsHeight*4), img.Bounds())
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	black := color.RGBA{0x00, 0x00, 0x00, 0xFF}
+	assert.Equal(t, white, color.RGBAModel.Convert(img.At(12, 4)))
+	assert.Equal(t, white, color.RGBAModel.Convert(img.At(15, 7)))
+	assert.Equal(t, black, color.RGBAModel.Convert(img.At(16, 4)))
+	assert.Equal(t, black, color.RGBAModel.Convert(img.At(0, 0)))
+}
+
+func TestGraphics_SetResolution(t *testing.T) {
+	g := &Graphics{}
+	g.Set(1, 1, true)
+
+	g.SetResolution(128, 64)
+	assert.Equal(t, 128, g.Width())
+	assert.Equal(t, 64, g.Height())
+	assert.False(t, g.GetPixel(1, 1))
+
+	g.Set(127, 63, true)
+	assert.True(t, g.GetPixel(127, 63))
+
+	g.SetResolution(1000, 1000)
+	assert.Equal(t, MaxGraphicsWidth, g.Width())
+	assert.Equal(t, MaxGraphicsHeight, g.Height())
+}
+
+func TestGraphics_WriteSpriteTracked(t *testing.T) {
+	g := &Graphics{}
+
+	collision, touched := g.WriteSpriteTracked([]byte{0xC0, 0x01}, 62, 31)
+	assert.False(t, collision)
+	// Rows and columns that run off the screen wrap around.
+	assert.Equal(t, []int{
+		62 + 31*GraphicsWidth,
+		63 + 31*GraphicsWidth,
+		5,
+	}, touched)
+
+	collision, touched = g.WriteSpriteTracked([]byte{0x80}, 62, 31)
+	assert.True(t, collision)
+	assert.Equal(t, []int{62 + 31*GraphicsWidth}, touched)
+	assert.False(t, g.GetPixel(62, 31))
+}
+
+func TestGraphics_Flip(t *testing.T) {
+	g := &Graphics{}
+	g.Set(0, 0, true)
+	g.Set(1, 0, true)
+	g.Set(0, 1, true)
+
+	g.FlipHorizontal()
+	assert.True(t, g.GetPixel(63, 0))
+	assert.True(t, g.GetPixel(62, 0))
+	assert.True(t, g.GetPixel(63, 1))
+	assert.False(t, g.GetPixel(62, 1))
+	assert.False(t, g.GetPixel(0, 0))
+
+	g.FlipVertical()
+	assert.True(t, g.GetPixel(63, 31))
+	assert.True(t, g.GetPixel(62, 31))
+	assert.True(t, g.GetPixel(63, 30))
+	assert.False(t, g.GetPixel(62, 30))
+	assert.False(t, g.GetPixel(63, 0))
+}
+
+func TestGraphics_FlipPlanesAndColors(t *testing.T) {
+	g := &Graphics{}
+	g.SetPlanes(0x02)
+	g.Set(2, 1, true)
+	g.SetColor(2, 1, ColorGreen)
+
+	g.FlipHorizontal()
+	assert.True(t, g.GetPlanePixel(1, 61, 1))
+	assert.False(t, g.GetPlanePixel(1, 2, 1))
+	assert.Equal(t, ColorGreen, g.Color(61, 1))
+	assert.Equal(t, DefaultColor, g.Color(2, 1))
+
+	g.FlipVertical()
+	assert.True(t, g.GetPlanePixel(1, 61, 30))
+	assert.False(t, g.GetPlanePixel(1, 61, 1))
+	assert.Equal(t, ColorGreen, g.Color(61, 30))
+	assert.Equal(t, DefaultColor, g.Color(61, 1))
+
+	minX, minY, maxX, maxY, empty := g.BoundingBox()
+	assert.False(t, empty)
+	assert.Equal(t, []int{61, 30, 61, 30}, []int{minX, minY, maxX, maxY})
+	assert.Equal(t, 1, g.CountOnPixels())
+}
+
+func TestGraphics_WriteSprite_wrapCollisions(t *testing.T) {
+	tests := []struct {
+		name   string
+		x, y   byte
+		pixelX uint16
+		pixelY uint16
+		sprite []byte
+		want   bool
+	}{
+		// The sprite's second column wraps to x=0.
+		{"right edge", 63, 0, 0, 0, []byte{0xC0}, true},
+		// The sprite's second row wraps to y=0.
+		{"bottom edge", 0, 31, 0, 0, []byte{0x80, 0x80}, true},
+		// Both wrap to the top left corner.
+		{"corner", 63, 31, 0, 0, []byte{0x00, 0x40}, true},
+		// The pixel lies in the sprite's box, but under an unset bit.
+		{"unset bit over pixel", 63, 0, 0, 0, []byte{0x80}, false},
+		// Positions past the edge wrap before drawing.
+		{"start past edge", 64 + 10, 32 + 5, 10, 5, []byte{0x80}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Graphics{}
+			g.Set(tt.pixelX, tt.pixelY, true)
+
+			assert.Equal(t, tt.want, g.WriteSprite(tt.sprite, tt.x, tt.y))
+			assert.Equal(t, !tt.want, g.GetPixel(tt.pixelX, tt.pixelY))
+		})
+	}
+}
+
+func TestGraphics_PackedBytes(t *testing.T) {
+	g := &Graphics{}
+	g.WriteSprite([]byte{0xF0, 0x90}, 4, 1)
+
+	b := g.PackedBytes()
+	assert.Len(t, b, GraphicsWidth/8*GraphicsHeight)
+	assert.Equal(t, []byte{0x0F, 0x00}, b[8:10])
+	assert.Equal(t, []byte{0x09, 0x00}, b[16:18])
+	for i, v := range b {
+		if i != 8 && i != 16 {
+			assert.Zero(t, v, "byte %d", i)
+		}
+	}
+
+	g.SetResolution(12, 2)
+	g.Set(11, 1, true)
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x10}, g.PackedBytes())
+}
+
+func TestGraphics_MarshalBinary(t *testing.T) {
+	g := &Graphics{}
+	g.WriteSprite(FONT[5:10], 10, 3) // "1"
+	g.WriteSprite(FONT[10:15], 60, 30)
+
+	b, err := g.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xFF, 0x02, 0x00, 0x40, 0x00, 0x20, 0x00, 0x00}, b[:8])
+	assert.Len(t, b, 8+3*GraphicsWidth/8*GraphicsHeight)
+
+	got := &Graphics{}
+	got.SetResolution(MaxGraphicsWidth, MaxGraphicsHeight)
+	assert.NoError(t, got.UnmarshalBinary(b))
+	assert.Equal(t, g.String(), got.String())
+	assert.Equal(t, g.pixels, got.pixels)
+
+	again, err := got.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, b, again)
+
+	g.SetResolution(12, 3)
+	g.Set(11, 2, true)
+	g.SetPlanes(0x02)
+	g.Set(0, 0, true)
+	g.SetColor(8, 1, ColorRed)
+	g.background = 1
+	b, _ = g.MarshalBinary()
+	assert.Equal(t, []byte{
+		0xFF, 0x02, 0x00, 0x0C, 0x00, 0x03, 0x82, 0x01,
+		0, 0, 0, 0, 0x00, 0x10, // first plane
+		0x80, 0, 0, 0, 0, 0, // second plane
+		0, 0, 0, ColorRed + 1, 0, 0, // colors
+	}, b)
+	assert.NoError(t, got.UnmarshalBinary(b))
+	assert.Equal(t, "#...........\n............\n...........#\n", got.String())
+	assert.True(t, got.GetPlanePixel(1, 0, 0))
+	assert.False(t, got.GetPixel(0, 0))
+	assert.Equal(t, byte(0x02), got.Planes())
+	assert.Equal(t, ColorRed, got.Color(8, 1))
+	assert.Equal(t, ColorBlue, got.Background())
+
+	// The first version only had the first plane.
+	assert.NoError(t, got.UnmarshalBinary([]byte{0x00, 0x0C, 0x00, 0x03, 0, 0, 0, 0, 0x00, 0x10}))
+	assert.Equal(t, "............\n............\n...........#\n", got.String())
+
+	assert.Error(t, got.UnmarshalBinary([]byte{0x00, 0x40}))
+	assert.Error(t, got.UnmarshalBinary([]byte{0x00, 0x00, 0x00, 0x20}))
+	assert.Error(t, got.UnmarshalBinary([]byte{0xFF, 0x03, 0x00, 0x0C, 0x00, 0x03, 0, 0}))
+	assert.Error(t, got.UnmarshalBinary(b[:len(b)-1]))
+
+	// Planes and colors that don't exist are rejected rather than drawn.
+	bad := bytes.Clone(b)
+	bad[6] = 0x04
+	assert.Error(t, got.UnmarshalBinary(bad))
+	bad = bytes.Clone(b)
+	bad[len(bad)-1] = 200
+	assert.Error(t, got.UnmarshalBinary(bad))
+	bad[len(bad)-1] = byte(len(ColorPalette))
+	assert.NoError(t, got.UnmarshalBinary(bad))
+	img := image.NewRGBA(image.Rect(0, 0, 12, 3))
+	assert.NotPanics(t, func() { got.RenderColorTo(img, 1) })
+}
+
+func TestGraphics_String(t *testing.T) {
+	g := &Graphics{}
+	g.SetResolution(4, 2)
+	g.Set(0, 0, true)
+	g.Set(3, 1, true)
+
+	assert.Equal(t, "#...\n...#\n", g.String())
+}
+
+func TestGraphics_RegionString(t *testing.T) {
+	g := &Graphics{}
+	// The font's 0 at (20, 10).
+	g.WriteSprite(FONT[0:5], 20, 10)
+
+	assert.Equal(t, ""+
+		"......\n"+
+		".####.\n"+
+		".#..#.\n"+
+		".#..#.\n"+
+		".#..#.\n"+
+		".####.\n"+
+		"......\n", g.RegionString(19, 9, 6, 7))
+
+	// Clipped to the screen.
+	assert.Equal(t, ".\n.\n", g.RegionString(63, 30, 5, 5))
+	assert.Equal(t, "..\n", g.RegionString(-3, -3, 5, 4))
+	assert.Equal(t, "", g.RegionString(64, 0, 4, 4))
+	assert.Equal(t, "", g.RegionString(0, 0, 0, 4))
+	assert.Equal(t, "", g.RegionString(10, 10, -2, -2))
+}
+
+func TestGraphics_CountOnPixels(t *testing.T) {
+	g := &Graphics{}
+	assert.Equal(t, 0, g.CountOnPixels())
+
+	g.WriteSprite(FONT[0:5], 0, 0) // "0"
+	assert.Equal(t, 14, g.CountOnPixels())
+
+	g.SetResolution(MaxGraphicsWidth, MaxGraphicsHeight)
+	g.Set(MaxGraphicsWidth-1, MaxGraphicsHeight-1, true)
+	assert.Equal(t, 1, g.CountOnPixels())
+
+	g.Clear()
+	assert.Equal(t, 0, g.CountOnPixels())
+}
+
+func TestGraphics_BoundingBox(t *testing.T) {
+	var g Graphics
+	_, _, _, _, empty := g.BoundingBox()
+	assert.True(t, empty)
+
+	g.WriteSprite(FONT[5:10], 20, 10) // "1", 0x20 0x60 0x20 0x20 0x70
+	minX, minY, maxX, maxY, empty := g.BoundingBox()
+	assert.False(t, empty)
+	assert.Equal(t, []int{21, 10, 23, 14}, []int{minX, minY, maxX, maxY})
+
+	g.Set(63, 0, true)
+	minX, minY, maxX, maxY, _ = g.BoundingBox()
+	assert.Equal(t, []int{21, 0, 63, 14}, []int{minX, minY, maxX, maxY})
+
+	g.Clear()
+	g.Set(5, 7, true)
+	minX, minY, maxX, maxY, empty = g.BoundingBox()
+	assert.False(t, empty)
+	assert.Equal(t, []int{5, 7, 5, 7}, []int{minX, minY, maxX, maxY})
+}
+
+func TestGraphics_ScaledEachPixel(t *testing.T) {
+	g := &Graphics{}
+	g.SetResolution(4, 2)
+	g.Set(1, 1, true)
+
+	visited, on := 0, 0
+	var lit [][2]int
+	g.ScaledEachPixel(3, func(x, y int, o bool) {
+		visited++
+		if o {
+			on++
+			lit = append(lit, [2]int{x, y})
+		}
+	})
+	assert.Equal(t, 4*3*2*3, visited)
+	assert.Equal(t, 9, on)
+	assert.Equal(t, [2]int{3, 3}, lit[0])
+	assert.Equal(t, [2]int{5, 5}, lit[8])
+
+	visited = 0
+	g.ScaledEachPixel(g.Scale, func(int, int, bool) { visited++ })
+	assert.Equal(t, 8, visited)
+}
+
+func TestTermboxDisplay_Render_incremental(t *testing.T) {
+	type cell struct {
+		x, y int
+		ch   rune
+	}
+	var cells []cell
+	flushes := 0
+	d := &TermboxDisplay{
+		setCell: func(x, y int, ch rune, _, _ termbox.Attribute) {
+			cells = append(cells, cell{x, y, ch})
+		},
+		flush: func() error {
+			flushes++
+			return nil
+		},
+	}
+	g := &Graphics{}
+
+	// The first frame writes every cell.
+	g.Set(1, 1, true)
+	assert.NoError(t, d.Render(g))
+	assert.Len(t, cells, GraphicsWidth*GraphicsHeight)
+	assert.Equal(t, 1, flushes)
+
+	// Later frames only write the cells that changed.
+	cells = nil
+	g.Set(1, 1, true)
+	g.Set(5, 2, true)
+	assert.NoError(t, d.Render(g))
+	assert.Equal(t, []cell{{1, 1, ' '}, {5, 2, '█'}}, cells)
+	assert.Equal(t, 2, flushes)
+
+	cells = nil
+	assert.NoError(t, d.Render(g))
+	assert.Empty(t, cells)
+	assert.Equal(t, 3, flushes)
+
+	// A new resolution redraws everything, and blanks the cells the old
+	// one leaves outside the new screen.
+	g.SetResolution(8, 4)
+	assert.NoError(t, d.Render(g))
+	assert.Len(t, cells, GraphicsWidth*GraphicsHeight)
+	assert.Contains(t, cells, cell{63, 31, ' '})
+	assert.Contains(t, cells, cell{8, 0, ' '})
+
+	// A bigger one has nothing to blank.
+	cells = nil
+	g.SetResolution(16, 8)
+	assert.NoError(t, d.Render(g))
+	assert.Len(t, cells, 16*8)
+}
+
+func TestTermboxDisplay_Render_runes(t *testing.T) {
+	seen := map[rune]int{}
+	d := &TermboxDisplay{
+		OnRune:  '#',
+		OffRune: '.',
+		setCell: func(_, _ int, ch rune, _, _ termbox.Attribute) {
+			seen[ch]++
+		},
+		flush: func() error { return nil },
+	}
+	g := &Graphics{}
+	g.SetResolution(4, 2)
+	g.Set(1, 1, true)
+
+	assert.NoError(t, d.Render(g))
+	assert.Equal(t, map[rune]int{'#': 1, '.': 7}, seen)
+}
+
+func TestGraphics_Pixels(t *testing.T) {
+	g := &Graphics{}
+	g.WriteSprite([]byte{0x80}, 3, 2)
+	assert.Equal(t, byte(1), g.Pixels[3+2*GraphicsWidth])
+
+	g.FlipHorizontal()
+	assert.Equal(t, byte(0), g.Pixels[3+2*GraphicsWidth])
+	assert.Equal(t, byte(1), g.Pixels[60+2*GraphicsWidth])
+
+	g.Clear()
+	assert.Equal(t, [GraphicsWidth * GraphicsHeight]byte{}, g.Pixels)
+
+	// It isn't kept up to date at other resolutions.
+	g.SetResolution(HiResWidth, HiResHeight)
+	g.Set(0, 0, true)
+	assert.Zero(t, g.Pixels[0])
+}
+
+func TestGraphics_SetResolutionClearsOldScreen(t *testing.T) {
+	g := &Graphics{}
+	g.SetResolution(HiResWidth, HiResHeight)
+	g.Set(HiResWidth-1, HiResHeight-1, true)
+	g.SetColor(HiResWidth-1, HiResHeight-1, ColorRed)
+
+	// Nothing is left past the smaller screen.
+	g.SetResolution(GraphicsWidth, GraphicsHeight)
+	var empty Graphics
+	assert.Equal(t, empty.pixels, g.pixels)
+	assert.Equal(t, empty.colors, g.colors)
+}
+
+func TestTermboxDisplay_RenderText(t *testing.T) {
+	rows := map[int]bool{}
+	d := &TermboxDisplay{
+		setCell: func(_, y int, _ rune, _, _ termbox.Attribute) {
+			rows[y] = true
+		},
+		flush: func() error { return nil },
+	}
+	assert.NoError(t, d.RenderText("a"))
+	assert.Equal(t, map[int]bool{GraphicsHeight + 1: true}, rows)
+
+	// In hi-res the text goes below the taller screen.
+	g := &Graphics{}
+	g.SetResolution(HiResWidth, HiResHeight)
+	assert.NoError(t, d.Render(g))
+	rows = map[int]bool{}
+	assert.NoError(t, d.RenderText("a\nb"))
+	assert.Equal(t, map[int]bool{HiResHeight + 1: true, HiResHeight + 2: true}, rows)
+}
@@ -0,0 +1,110 @@
+package chip8
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Intel HEX record types.
+const (
+	ihexData                   = 0x00
+	ihexEOF                    = 0x01
+	ihexExtendedSegmentAddress = 0x02
+	ihexStartSegmentAddress    = 0x03
+	ihexExtendedLinearAddress  = 0x04
+	ihexStartLinearAddress     = 0x05
+)
+
+// LoadHex loads a program in Intel HEX format, placing each data record at
+// the address it specifies. All data must fall between 0x200 and the end of
+// memory. It returns the number of bytes loaded.
+func (c *CPU) LoadHex(r io.Reader) (int, error) {
+	var (
+		n    int
+		base int
+		line int
+	)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line++
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			continue
+		}
+
+		rec, err := parseIHexRecord(text)
+		if err != nil {
+			return n, fmt.Errorf("chip8: intel hex line %d: %s", line, err.Error())
+		}
+
+		switch rec.typ {
+		case ihexData:
+			addr := base + int(rec.addr)
+			if addr < 0x200 || addr+len(rec.data) > len(c.Memory) {
+				return n, fmt.Errorf("chip8: intel hex line %d: data at 0x%04X is outside 0x200-0x%03X", line, addr, len(c.Memory)-1)
+			}
+			n += copy(c.Memory[addr:], rec.data)
+		case ihexEOF:
+			return n, nil
+		case ihexExtendedSegmentAddress, ihexExtendedLinearAddress:
+			if len(rec.data) != 2 {
+				return n, fmt.Errorf("chip8: intel hex line %d: bad address record", line)
+			}
+			base = int(rec.data[0])<<8 | int(rec.data[1])
+			if rec.typ == ihexExtendedSegmentAddress {
+				base <<= 4
+			} else {
+				base <<= 16
+			}
+		case ihexStartSegmentAddress, ihexStartLinearAddress:
+			// Start addresses don't apply; CHIP-8 programs start at 0x200.
+		default:
+			return n, fmt.Errorf("chip8: intel hex line %d: unknown record type 0x%02X", line, rec.typ)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return n, err
+	}
+
+	return n, fmt.Errorf("chip8: intel hex: missing end of file record")
+}
+
+type ihexRecord struct {
+	typ  byte
+	addr uint16
+	data []byte
+}
+
+// parseIHexRecord parses a single ":LLAAAATT[DD...]CC" record and verifies
+// its checksum.
+func parseIHexRecord(text string) (ihexRecord, error) {
+	if text[0] != ':' {
+		return ihexRecord{}, fmt.Errorf("record doesn't start with ':'")
+	}
+
+	b, err := hex.DecodeString(text[1:])
+	if err != nil {
+		return ihexRecord{}, err
+	}
+	if len(b) < 5 || len(b) != 5+int(b[0]) {
+		return ihexRecord{}, fmt.Errorf("bad record length")
+	}
+
+	var sum byte
+	for _, v := range b {
+		sum += v
+	}
+	if sum != 0 {
+		return ihexRecord{}, fmt.Errorf("bad checksum")
+	}
+
+	return ihexRecord{
+		typ:  b[3],
+		addr: uint16(b[1])<<8 | uint16(b[2]),
+		data: b[4 : len(b)-1],
+	}, nil
+}
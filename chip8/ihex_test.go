@@ -0,0 +1,36 @@
+package chip8
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPU_LoadHex(t *testing.T) {
+	cpu := NewCPU(nil)
+	n, err := cpu.LoadHex(strings.NewReader(`
+:04020000600561052F
+:02030000ABCD83
+:00000001FF
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 6, n)
+	assert.Equal(t, []byte{0x60, 0x05, 0x61, 0x05}, cpu.Memory[0x200:0x204])
+	assert.Equal(t, []byte{0xAB, 0xCD}, cpu.Memory[0x300:0x302])
+}
+
+func TestCPU_LoadHex_invalid(t *testing.T) {
+	for _, src := range []string{
+		":04020000600561052E\n:00000001FF\n", // bad checksum
+		":02010000ABCD85\n:00000001FF\n",     // below 0x200
+		":02100000ABCD76\n:00000001FF\n",     // past the end of memory
+		":04020000600561052F\n",              // no EOF record
+		"04020000600561052F\n:00000001FF\n",  // no start code
+	} {
+		_, err := NewCPU(nil).LoadHex(strings.NewReader(src))
+		assert.Error(t, err, src)
+	}
+}
@@ -1,8 +1,13 @@
 package chip8
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
 
 	"github.com/nsf/termbox-go"
 )
@@ -17,16 +22,408 @@ func (f KeypadFunc) GetKey() (byte, error) {
 	return f()
 }
 
+// KeyPoller is implemented by Keypads that can report which keys are held
+// down, not only wait for the next press. The CPU calls PollKeys before
+// every instruction, and PollKeys reports the keys with CPU.PressKey and
+// CPU.ReleaseKey, so EX9E and EXA1 see keys held during play. It must not
+// block. Errors are handled as errors from GetKey are.
+type KeyPoller interface {
+	PollKeys(c *CPU) error
+}
+
+// DefaultKeyHold is how long a key stays held down after it was last
+// pressed, for keypads that see key presses but not releases.
+const DefaultKeyHold = 250 * time.Millisecond
+
+// keyEvent is a key press, a hotkey to run or an error read by a keyFeed.
+type keyEvent struct {
+	key byte
+	fn  func()
+	err error
+}
+
+// keyFeed turns a source that blocks until a key is pressed into the held
+// key state of a CPU. It reads the source in the background, from the
+// first poll, and poll presses the keys read since the last poll and
+// releases the keys that haven't been pressed for hold. If register is
+// given, it decides whether a key read counts as a new press, as
+// TermboxKeypad's Debounce and Repeat do: a key it turns down stays held
+// without being pressed again, and a key it lets through while held is let
+// go and pressed again, so FX0A sees it.
+//
+// The reader stops once the CPU stops running: when the RunContext it was
+// started under returns, or Stop is called. A read already under way can't
+// be interrupted, so it stops after that read. The next poll starts it
+// again. After an error it waits before reading again, longer each time
+// the error persists, so a broken source isn't read in a busy loop.
+type keyFeed struct {
+	events chan keyEvent
+	down   uint16
+	seen   [16]time.Time
+
+	// exited is closed when the reader stops. It is nil before the first
+	// poll.
+	exited chan struct{}
+}
+
+// The wait after a read error starts at minKeyErrorBackoff and doubles with
+// each error in a row, up to maxKeyErrorBackoff.
+const (
+	minKeyErrorBackoff = 10 * time.Millisecond
+	maxKeyErrorBackoff = time.Second
+)
+
+func (f *keyFeed) poll(c *CPU, read func() keyEvent, register func(key byte, now time.Time) bool, now time.Time, hold time.Duration) error {
+	if f.events == nil {
+		f.events = make(chan keyEvent, 16)
+	}
+	if !f.reading() {
+		f.start(c, read)
+	}
+	if hold <= 0 {
+		hold = DefaultKeyHold
+	}
+	for {
+		select {
+		case ev := <-f.events:
+			switch {
+			case ev.err != nil:
+				return ev.err
+			case ev.fn != nil:
+				ev.fn()
+			default:
+				if err := f.press(c, ev.key, register, now); err != nil {
+					return err
+				}
+			}
+		default:
+			for k := byte(0); k < 16; k++ {
+				if f.down&(1<<k) != 0 && now.Sub(f.seen[k]) >= hold {
+					f.down &^= 1 << k
+					c.setKey(k, false)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// reading reports whether the reader is running.
+func (f *keyFeed) reading() bool {
+	if f.exited == nil {
+		return false
+	}
+	select {
+	case <-f.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// start starts the reader for as long as c runs. If c has been stopped, it
+// isn't started.
+func (f *keyFeed) start(c *CPU, read func() keyEvent) {
+	stop := c.stop
+	var done <-chan struct{}
+	if c.runCtx != nil {
+		done = c.runCtx.Done()
+	}
+	select {
+	case <-stop:
+		return
+	case <-done:
+		return
+	default:
+	}
+
+	exited := make(chan struct{})
+	f.exited = exited
+	go func() {
+		defer close(exited)
+		var backoff time.Duration
+		for {
+			select {
+			case <-stop:
+				return
+			case <-done:
+				return
+			default:
+			}
+
+			ev := read()
+			select {
+			case f.events <- ev:
+			case <-stop:
+				return
+			case <-done:
+				return
+			}
+			if ev.err == ErrQuit {
+				return
+			}
+			if ev.err == nil {
+				backoff = 0
+				continue
+			}
+
+			backoff = min(max(2*backoff, minKeyErrorBackoff), maxKeyErrorBackoff)
+			t := time.NewTimer(backoff)
+			select {
+			case <-t.C:
+			case <-stop:
+				t.Stop()
+				return
+			case <-done:
+				t.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// press presses key on c for poll, unless register turns it down.
+func (f *keyFeed) press(c *CPU, key byte, register func(key byte, now time.Time) bool, now time.Time) error {
+	if key > 0x0F {
+		return &InvalidKey{Key: key}
+	}
+	down := f.down&(1<<key) != 0
+	if register != nil {
+		if !register(key, now) {
+			if down {
+				f.seen[key] = now
+			}
+			return nil
+		}
+		if down {
+			c.setKey(key, false)
+		}
+	}
+	c.setKey(key, true)
+	f.down |= 1 << key
+	f.seen[key] = now
+	return nil
+}
+
+// ErrNoKeypad is returned by NullKeypad.
+var ErrNoKeypad = errors.New("chip8: null keypad not usable")
+
 var NullKeypad = KeypadFunc(func() (byte, error) {
-	return 0x00, errors.New("null keypad not usable")
+	return 0x00, ErrNoKeypad
 })
 
-type TermboxKeypad struct{}
+// ScriptedInput is a key press scheduled for a cycle, as counted by
+// CPU.Cycles.
+type ScriptedInput struct {
+	Cycle uint64
+	Key   byte
+
+	// Hold is how many cycles the key is held down for. If zero, it is
+	// held for one cycle.
+	Hold uint64
+}
+
+// end returns the cycle at which the key is let go.
+func (in ScriptedInput) end() uint64 {
+	if in.Hold == 0 {
+		return in.Cycle + 1
+	}
+	return in.Cycle + in.Hold
+}
+
+// ErrScriptExhausted is returned by a ScriptedKeypad that has run out of
+// inputs.
+var ErrScriptExhausted = errors.New("chip8: keypad script exhausted")
+
+// ErrNoKey is returned by a ScriptedKeypad asked for a key before the next
+// one is scheduled. FX0A skips it and asks again on the next cycle.
+var ErrNoKey = errors.New("chip8: no key pressed yet")
+
+// ScriptedKeypad is a Keypad that presses keys at scheduled cycles, for
+// tests that need deterministic input. Each key is held down from its
+// cycle for its Hold, which EX9E and EXA1 see. FX0A waits for a new key
+// press, so inputs scheduled before it runs are missed, as they would be
+// on real hardware. Once the script has been played, FX0A fails with
+// ErrScriptExhausted.
+type ScriptedKeypad struct {
+	cpu    *CPU
+	script []ScriptedInput
+
+	// next is the next input for GetKey and polled the next input for
+	// PollKeys to press. held are the inputs PollKeys has pressed and not
+	// yet let go.
+	next, polled int
+	held         []ScriptedInput
+}
+
+// NewScriptedKeypad returns a ScriptedKeypad for cpu that plays script,
+// which must be in cycle order.
+func NewScriptedKeypad(cpu *CPU, script []ScriptedInput) *ScriptedKeypad {
+	return &ScriptedKeypad{
+		cpu:    cpu,
+		script: script,
+	}
+}
+
+// GetKey returns the key held down at the current cycle, or ErrNoKey if
+// the next one isn't due yet.
+func (k *ScriptedKeypad) GetKey() (byte, error) {
+	now := k.cpu.Cycles()
+	for k.next < len(k.script) {
+		in := k.script[k.next]
+		if now < in.Cycle {
+			return 0, ErrNoKey
+		}
+		k.next++
+		if now < in.end() {
+			return in.Key, nil
+		}
+	}
+	return 0, ErrScriptExhausted
+}
+
+// PollKeys presses and lets go of the keys scheduled up to the current
+// cycle.
+func (k *ScriptedKeypad) PollKeys(c *CPU) error {
+	now := c.Cycles()
+	held := k.held[:0]
+	for _, in := range k.held {
+		if now >= in.end() {
+			c.setKey(in.Key, false)
+			continue
+		}
+		held = append(held, in)
+	}
+	k.held = held
+
+	for k.polled < len(k.script) && k.script[k.polled].Cycle <= now {
+		in := k.script[k.polled]
+		k.polled++
+		if err := c.PressKey(in.Key); err != nil {
+			return err
+		}
+		k.held = append(k.held, in)
+	}
+
+	// FX0A under Quirks.WaitKeyOnRelease may still complete on a key
+	// just let go.
+	if k.polled == len(k.script) && len(k.held) == 0 && !c.waiting && c.waitingForKey() {
+		return ErrScriptExhausted
+	}
+	return nil
+}
+
+// GamepadKeypad is a Keypad for game controllers. The caller supplies the
+// gamepad library through Poll, so the package doesn't depend on one.
+type GamepadKeypad struct {
+	// ButtonMap maps gamepad button indices to CHIP-8 keys. Presses of
+	// buttons that aren't mapped are ignored.
+	ButtonMap map[int]byte
+
+	// Poll blocks until a button is pressed and returns its index.
+	Poll func() (button int, err error)
+
+	// Hold is how long a button stays held down for EX9E and EXA1 after it
+	// was last pressed, as Poll doesn't report releases. If zero,
+	// DefaultKeyHold is used.
+	Hold time.Duration
+
+	feed keyFeed
+}
+
+// NewGamepadKeypad returns a GamepadKeypad using the given button map and
+// polling function.
+func NewGamepadKeypad(m map[int]byte, poll func() (int, error)) *GamepadKeypad {
+	return &GamepadKeypad{
+		ButtonMap: m,
+		Poll:      poll,
+	}
+}
+
+func (k *GamepadKeypad) GetKey() (byte, error) {
+	for {
+		button, err := k.Poll()
+		if err != nil {
+			return 0x00, err
+		}
+		key, ok := k.ButtonMap[button]
+		if !ok {
+			continue
+		}
+		if key > 0x0F {
+			return 0x00, &InvalidKey{Key: key}
+		}
+		return key, nil
+	}
+}
+
+// PollKeys feeds the buttons pressed to c, holding each down for Hold as
+// timed by c's Timing. Once it has been called, Poll is read in the
+// background while c runs, and GetKey must not be used.
+func (k *GamepadKeypad) PollKeys(c *CPU) error {
+	return k.feed.poll(c, func() keyEvent {
+		key, err := k.GetKey()
+		return keyEvent{key: key, err: err}
+	}, nil, c.options.Timing.Now(), k.Hold)
+}
+
+type TermboxKeypad struct {
+	// KeyMap maps characters typed on the keyboard to CHIP-8 keys. If nil,
+	// the default QWERTY layout is used.
+	KeyMap map[rune]byte
+
+	// SpecialKeyMap maps keys that don't type a character, such as the
+	// arrow keys and space, to CHIP-8 keys. If nil, they are not used;
+	// ArrowKeyMap is a layout for playing with the arrows and space.
+	SpecialKeyMap map[termbox.Key]byte
+
+	// Hotkeys are keys that don't type a character, such as F12, that run
+	// a function instead of pressing a CHIP-8 key. They take precedence
+	// over SpecialKeyMap. While the CPU runs they are run on its goroutine,
+	// between instructions, so they can read its state but must not call
+	// the methods that wait for the run loop, such as Pause, Resume and
+	// Reload.
+	Hotkeys map[termbox.Key]func()
+
+	// Debounce ignores repeated presses of the same key that arrive less
+	// than Debounce apart. Terminals don't report key releases but send
+	// presses repeatedly while a key is held, so this makes a held key
+	// register once until it is let go.
+	Debounce time.Duration
+
+	// Repeat, if set, lets a debounced key that is held down register
+	// again every Repeat.
+	Repeat time.Duration
+
+	// Hold is how long a key stays held down for EX9E and EXA1 after the
+	// terminal last sent it. It should cover the terminal's delay before
+	// a held key starts repeating. If zero, DefaultKeyHold is used.
+	Hold time.Duration
+
+	// pollEvent and now are termbox.PollEvent and time.Now, unless
+	// replaced by tests. now only times GetKey; PollKeys uses the CPU's
+	// Timing.
+	pollEvent func() termbox.Event
+	now       func() time.Time
+
+	// The last key seen, when it was last seen and when it last
+	// registered.
+	held                bool
+	lastKey             byte
+	lastSeen, lastFired time.Time
+
+	feed keyFeed
+}
 
 func NewTermboxKeypad() *TermboxKeypad {
 	return &TermboxKeypad{}
 }
 
+// NewTermboxKeypadWithMap returns a TermboxKeypad using the given key map.
+func NewTermboxKeypadWithMap(m map[rune]byte) *TermboxKeypad {
+	return &TermboxKeypad{KeyMap: m}
+}
+
 var keyMap = map[rune]byte{
 	'1': 0x01, '2': 0x02, '3': 0x03, '4': 0x0C,
 	'q': 0x04, 'w': 0x05, 'e': 0x06, 'r': 0x0D,
@@ -36,16 +433,260 @@ var keyMap = map[rune]byte{
 
 var escapeKey = '0'
 
+// ArrowKeyMap maps the arrow keys to the same CHIP-8 keys as WASD in the
+// default layout, and space to the key of E, which many games use to move
+// and fire.
+var ArrowKeyMap = map[termbox.Key]byte{
+	termbox.KeyArrowUp:    0x05,
+	termbox.KeyArrowLeft:  0x07,
+	termbox.KeyArrowDown:  0x08,
+	termbox.KeyArrowRight: 0x09,
+	termbox.KeySpace:      0x06,
+}
+
+// KeyMapFromReader parses a key map from JSON. The JSON is an object mapping
+// single characters to hex CHIP-8 keys, for example:
+//
+//	{"1": "1", "2": "2", "3": "3", "4": "C"}
+func KeyMapFromReader(r io.Reader) (map[rune]byte, error) {
+	var raw map[string]string
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("chip8: unable to parse key map: %s", err.Error())
+	}
+
+	m := make(map[rune]byte, len(raw))
+	for k, v := range raw {
+		ch, size := utf8.DecodeRuneInString(k)
+		if size == 0 || size != len(k) {
+			return nil, fmt.Errorf("chip8: key map: %q is not a single character", k)
+		}
+		if ch == escapeKey {
+			return nil, fmt.Errorf("chip8: key map: %q is reserved for quitting", k)
+		}
+		key, err := strconv.ParseUint(v, 16, 8)
+		if err != nil || key > 0x0F {
+			return nil, fmt.Errorf("chip8: key map: %q is not a key between 0 and F", v)
+		}
+		m[ch] = byte(key)
+	}
+	return m, nil
+}
+
 func (k *TermboxKeypad) GetKey() (byte, error) {
-	event := termbox.PollEvent()
+	for {
+		event := k.poll()
+
+		if event.Ch == escapeKey {
+			return 0x00, ErrQuit
+		}
+		if fn, ok := k.Hotkeys[event.Key]; ok && event.Ch == 0 {
+			fn()
+			continue
+		}
+		key, err := k.lookup(event)
+		if err != nil {
+			return 0x00, err
+		}
+		if k.register(key, k.clock()) {
+			return key, nil
+		}
+	}
+}
 
-	if event.Ch == escapeKey {
-		return 0x00, ErrQuit
+// PollKeys feeds the keys typed to c, holding each down for Hold, and runs
+// the Hotkeys typed. Debounce and Repeat decide which of the presses the
+// terminal sends for a held key are new presses, as timed by c's Timing. Once it has been called,
+// the terminal is read in the background while c runs, and GetKey must not
+// be used.
+func (k *TermboxKeypad) PollKeys(c *CPU) error {
+	return k.feed.poll(c, k.readEvent, k.register, c.options.Timing.Now(), k.Hold)
+}
+
+// readEvent waits for a key press, a hotkey or the escape key, ignoring
+// keys that aren't mapped.
+func (k *TermboxKeypad) readEvent() keyEvent {
+	for {
+		event := k.poll()
+		if event.Type == termbox.EventError {
+			return keyEvent{err: event.Err}
+		}
+		if event.Ch == escapeKey {
+			return keyEvent{err: ErrQuit}
+		}
+		if fn, ok := k.Hotkeys[event.Key]; ok && event.Ch == 0 {
+			return keyEvent{fn: fn}
+		}
+		if key, err := k.lookup(event); err == nil {
+			return keyEvent{key: key}
+		}
+	}
+}
+
+// lookup returns the CHIP-8 key mapped to the key in event.
+func (k *TermboxKeypad) lookup(event termbox.Event) (byte, error) {
+	if event.Ch == 0 && k.SpecialKeyMap != nil {
+		key, ok := k.SpecialKeyMap[event.Key]
+		if !ok {
+			return 0x00, fmt.Errorf("unknown key: %v", event.Key)
+		}
+		return key, nil
 	}
-	key, ok := keyMap[event.Ch]
+	key, ok := k.keyMap()[event.Ch]
 	if !ok {
 		return 0x00, fmt.Errorf("unknown key: %v", event.Ch)
-
 	}
 	return key, nil
 }
+
+// register reports whether a press of key at now should be passed on,
+// applying Debounce and Repeat.
+func (k *TermboxKeypad) register(key byte, now time.Time) bool {
+	repeated := k.held && key == k.lastKey && now.Sub(k.lastSeen) < k.Debounce
+	k.held, k.lastKey, k.lastSeen = true, key, now
+
+	if repeated && (k.Repeat <= 0 || now.Sub(k.lastFired) < k.Repeat) {
+		return false
+	}
+	k.lastFired = now
+	return true
+}
+
+func (k *TermboxKeypad) poll() termbox.Event {
+	if k.pollEvent == nil {
+		return termbox.PollEvent()
+	}
+	return k.pollEvent()
+}
+
+func (k *TermboxKeypad) clock() time.Time {
+	if k.now == nil {
+		return time.Now()
+	}
+	return k.now()
+}
+
+func (k *TermboxKeypad) keyMap() map[rune]byte {
+	if k.KeyMap == nil {
+		return keyMap
+	}
+	return k.KeyMap
+}
+
+// PressKey marks key as held down, as seen by EX9E and EXA1. Front-ends call
+// it when a key goes down and ReleaseKey when it comes back up. Once keys
+// are fed this way, or the Keypad is a KeyPoller, EX9E and EXA1 read the
+// held keys and FX0A waits for a key to go down instead of asking the
+// Keypad.
+func (c *CPU) PressKey(key byte) error {
+	if key > 0x0F {
+		return &InvalidKey{Key: key}
+	}
+	c.setKey(key, true)
+	return nil
+}
+
+// ReleaseKey marks key as no longer held down.
+func (c *CPU) ReleaseKey(key byte) error {
+	if key > 0x0F {
+		return &InvalidKey{Key: key}
+	}
+	c.setKey(key, false)
+	return nil
+}
+
+// KeyState returns which of the 16 keys are currently held down.
+func (c *CPU) KeyState() [16]bool {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	return c.key
+}
+
+// setKey records key as held down or released.
+func (c *CPU) setKey(key byte, down bool) {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	key &= 0x0F
+	if down && !c.key[key] {
+		c.pressed |= 1 << key
+	}
+	c.key[key] = down
+	c.fed = true
+}
+
+// keyDown reports whether key is held down. Only the low nibble of key is
+// significant.
+func (c *CPU) keyDown(key byte) bool {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	return c.key[key&0x0F]
+}
+
+// takePresses returns the keys that went down since it was last called.
+func (c *CPU) takePresses() uint16 {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	p := c.pressed
+	c.pressed = 0
+	return p
+}
+
+// keysFed reports whether the held keys are known, because the Keypad is a
+// KeyPoller or they have been set with PressKey or ReleaseKey.
+func (c *CPU) keysFed() bool {
+	if _, ok := c.keypad().(KeyPoller); ok {
+		return true
+	}
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	return c.fed
+}
+
+// waitingForKey reports whether the next instruction is FX0A.
+func (c *CPU) waitingForKey() bool {
+	pc := int(c.ProgramCounter)
+	if pc+1 >= len(c.Memory) {
+		return false
+	}
+	return c.Memory[pc]&0xF0 == 0xF0 && c.Memory[pc+1] == 0x0A
+}
+
+// keyPressed reports whether key is pressed, for EX9E and EXA1. If the held
+// keys aren't fed, it asks the Keypad for a key, as there is no other way
+// to tell, and an error from the Keypad other than ErrQuit counts as not
+// pressed.
+func (c *CPU) keyPressed(key byte) (bool, error) {
+	if c.keysFed() {
+		return c.keyDown(key), nil
+	}
+	b, ok, err := c.getKey()
+	if err == ErrQuit {
+		return false, err
+	}
+	return ok && b == key, nil
+}
+
+// pollKeys lets a KeyPoller Keypad feed the held keys.
+func (c *CPU) pollKeys() error {
+	p, ok := c.keypad().(KeyPoller)
+	if !ok {
+		return nil
+	}
+	err := p.PollKeys(c)
+	if err == nil || err == ErrQuit {
+		return err
+	}
+	if !c.keypadErrorFatal(err) {
+		c.options.Logger.Debug("chip8: keypad error skipped", "error", err)
+		return nil
+	}
+	return fmt.Errorf("chip8: unable to get key from keypad: %w", err)
+}
+
+// InvalidKey is returned when a key outside 0x0-0xF is pressed or released.
+type InvalidKey struct {
+	Key byte
+}
+
+func (e *InvalidKey) Error() string {
+	return fmt.Sprintf("chip8: invalid key: 0x%02X", e.Key)
+}
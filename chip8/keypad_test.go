@@ -0,0 +1,594 @@
+package chip8
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyMapFromReader(t *testing.T) {
+	m, err := KeyMapFromReader(strings.NewReader(`{"j": "0", "k": "a", "é": "F"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[rune]byte{'j': 0x00, 'k': 0x0A, 'é': 0x0F}, m)
+
+	k := NewTermboxKeypadWithMap(m)
+	assert.Equal(t, m, k.keyMap())
+	assert.Equal(t, keyMap, NewTermboxKeypad().keyMap())
+}
+
+func TestKeyMapFromReader_invalid(t *testing.T) {
+	for _, config := range []string{
+		`{"jk": "0"}`,
+		`{"": "0"}`,
+		`{"0": "1"}`,
+		`{"j": "10"}`,
+		`{"j": "g"}`,
+		`["j"]`,
+	} {
+		_, err := KeyMapFromReader(strings.NewReader(config))
+		assert.Error(t, err, config)
+	}
+}
+
+func TestCPU_KeyState(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.setKey(0x03, true)
+	cpu.setKey(0x0C, true)
+	cpu.setKey(0x05, true)
+	cpu.setKey(0x05, false)
+
+	var want [16]bool
+	want[0x03] = true
+	want[0x0C] = true
+	assert.Equal(t, want, cpu.KeyState())
+}
+
+func TestCPU_PressKey(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0xE0, 0x9E, // SKP V0
+		0x00, 0x00, // skipped
+		0xE0, 0xA1, // SKNP V0
+	})
+	cpu.V[0] = 0x0A
+
+	assert.NoError(t, cpu.PressKey(0x0A))
+	if err := cpu.RunN(1); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint16(0x204), cpu.ProgramCounter)
+
+	assert.NoError(t, cpu.ReleaseKey(0x0A))
+	if err := cpu.RunN(1); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint16(0x208), cpu.ProgramCounter)
+
+	assert.Equal(t, &InvalidKey{Key: 0x10}, cpu.PressKey(0x10))
+	assert.Equal(t, &InvalidKey{Key: 0xFF}, cpu.ReleaseKey(0xFF))
+}
+
+// scriptedTermbox feeds a TermboxKeypad characters typed at the given
+// offsets, in milliseconds, from the start of the script.
+func scriptedTermbox(k *TermboxKeypad, events []struct {
+	ms int
+	ch rune
+}) {
+	start := time.Unix(0, 0)
+	i := -1
+	k.pollEvent = func() termbox.Event {
+		i++
+		return termbox.Event{Type: termbox.EventKey, Ch: events[i].ch}
+	}
+	k.now = func() time.Time {
+		return start.Add(time.Duration(events[i].ms) * time.Millisecond)
+	}
+}
+
+func TestTermboxKeypad_Debounce(t *testing.T) {
+	events := []struct {
+		ms int
+		ch rune
+	}{
+		{0, '1'}, {30, '1'}, {60, '1'}, // held, registers once
+		{200, '1'},             // released and pressed again
+		{210, 'q'}, {220, 'q'}, // another key, held
+		{230, '1'}, // different key registers at once
+		{0, '0'},
+	}
+
+	var got []byte
+	k := NewTermboxKeypad()
+	k.Debounce = 50 * time.Millisecond
+	scriptedTermbox(k, events)
+	for {
+		key, err := k.GetKey()
+		if err == ErrQuit {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, key)
+	}
+	assert.Equal(t, []byte{0x01, 0x01, 0x04, 0x01}, got)
+}
+
+func TestTermboxKeypad_Repeat(t *testing.T) {
+	events := []struct {
+		ms int
+		ch rune
+	}{
+		{0, '1'}, {30, '1'}, {60, '1'}, {90, '1'}, {120, '1'}, {150, '1'},
+		{0, '0'},
+	}
+
+	var got []int
+	k := NewTermboxKeypad()
+	k.Debounce = 50 * time.Millisecond
+	k.Repeat = 60 * time.Millisecond
+	scriptedTermbox(k, events)
+	for {
+		_, err := k.GetKey()
+		if err == ErrQuit {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, k.lastFired.Nanosecond()/int(time.Millisecond))
+	}
+	assert.Equal(t, []int{0, 60, 120}, got)
+}
+
+func TestTermboxKeypad_DebounceRepeatPolled(t *testing.T) {
+	tests := []struct {
+		name             string
+		debounce, repeat time.Duration
+		presses          []int // ms at which '1' is typed
+		want             []byte
+	}{
+		{
+			"debounce", 50 * time.Millisecond, 0,
+			[]int{0, 30, 60, 200, 230},
+			[]byte{1, 1, 1, 2, 2},
+		},
+		{
+			"repeat", 50 * time.Millisecond, 60 * time.Millisecond,
+			[]int{0, 30, 60, 90, 120, 150},
+			[]byte{1, 1, 2, 2, 3, 3},
+		},
+		{
+			"none", 0, 0,
+			[]int{0, 30, 60},
+			[]byte{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// pollEvent signals ready each time the reader asks for the
+			// next event, so the last one has been fed by then.
+			events := make(chan termbox.Event)
+			ready := make(chan struct{})
+			ft := newFakeTime()
+			start := ft.Now()
+			k := NewTermboxKeypad()
+			k.Debounce, k.Repeat = tt.debounce, tt.repeat
+			k.pollEvent = func() termbox.Event {
+				ready <- struct{}{}
+				return <-events
+			}
+
+			cpu := NewCPU(&Options{Timing: TimingFrom(ft)})
+			cpu.Keypad = k
+			cpu.LoadBytes([]byte{
+				0xF0, 0x0A, // LD V0, K
+				0x71, 0x01, // ADD V1, 1
+				0x12, 0x00, // JP 0x200
+			})
+			assert.NoError(t, cpu.RunN(1))
+			<-ready
+
+			// V1 counts the presses FX0A saw, while SKP would see the key
+			// held throughout.
+			var got []byte
+			for _, ms := range tt.presses {
+				ft.now = start.Add(time.Duration(ms) * time.Millisecond)
+				events <- termbox.Event{Type: termbox.EventKey, Ch: '1'}
+				<-ready
+				assert.NoError(t, cpu.RunN(3))
+				assert.True(t, cpu.KeyState()[0x1])
+				got = append(got, cpu.V[1])
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestScriptedKeypad(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.Graphics.Display = NullDisplay
+	cpu.Keypad = NewScriptedKeypad(cpu, []ScriptedInput{
+		{Cycle: 0, Key: 0x3}, // missed, nothing is waiting yet
+		{Cycle: 4, Key: 0xA},
+	})
+	cpu.LoadBytes([]byte{
+		0x60, 0x05, // LD V0, 0x05
+		0xF1, 0x0A, // LD V1, K
+		0xF1, 0x29, // LD F, V1
+		0xD0, 0x05, // DRW V0, V0, 5
+		0xF2, 0x0A, // LD V2, K
+	})
+
+	// A is pressed at cycle 4, so FX0A is still waiting.
+	assert.NoError(t, cpu.RunN(4))
+	assert.Equal(t, uint16(0x202), cpu.ProgramCounter)
+	assert.Equal(t, byte(0), cpu.V[1])
+
+	assert.NoError(t, cpu.RunN(3))
+	assert.Equal(t, uint64(7), cpu.Cycles())
+	assert.Equal(t, byte(0xA), cpu.V[1])
+	// The top row of the font's "A" is 0xF0.
+	for x := uint16(5); x < 9; x++ {
+		assert.True(t, cpu.Graphics.GetPixel(x, 5))
+	}
+	assert.False(t, cpu.Graphics.GetPixel(9, 5))
+
+	assert.ErrorIs(t, cpu.RunN(1), ErrScriptExhausted)
+}
+
+func TestScriptedKeypad_SKP(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.Keypad = NewScriptedKeypad(cpu, []ScriptedInput{
+		{Cycle: 3, Key: 0x5, Hold: 4},
+	})
+	cpu.LoadBytes([]byte{
+		0x60, 0x05, // LD V0, 0x05
+		0xE0, 0x9E, // SKP V0
+		0x12, 0x02, // JP 0x202
+		0xE0, 0xA1, // SKNP V0
+		0x12, 0x06, // JP 0x206
+		0x12, 0x0A, // JP 0x20A
+	})
+
+	// SKP doesn't skip at cycle 1, but does at cycle 3 once 5 is down.
+	assert.NoError(t, cpu.RunN(4))
+	assert.Equal(t, uint16(0x206), cpu.ProgramCounter)
+
+	// SKNP loops until 5 is let go at cycle 7.
+	assert.NoError(t, cpu.RunN(3))
+	assert.Equal(t, uint16(0x208), cpu.ProgramCounter)
+	assert.NoError(t, cpu.RunN(2))
+	assert.Equal(t, uint16(0x20A), cpu.ProgramCounter)
+}
+
+func TestScriptedKeypad_GetKey(t *testing.T) {
+	cpu := NewCPU(nil)
+	k := NewScriptedKeypad(cpu, []ScriptedInput{
+		{Cycle: 0, Key: 0x3},
+		{Cycle: 2, Key: 0x7, Hold: 2},
+		{Cycle: 4, Key: 0x9},
+	})
+	cpu.LoadBytes([]byte{
+		0x12, 0x00, // JP 0x200
+	})
+
+	assert.NoError(t, cpu.RunN(1))
+	// 3 was only held at cycle 0 and 7 isn't due yet.
+	_, err := k.GetKey()
+	assert.Equal(t, ErrNoKey, err)
+
+	assert.NoError(t, cpu.RunN(2))
+	key, err := k.GetKey()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x7), key)
+
+	assert.NoError(t, cpu.RunN(5))
+	_, err = k.GetKey()
+	assert.Equal(t, ErrScriptExhausted, err)
+}
+
+func TestGamepadKeypad(t *testing.T) {
+	presses := []int{3, 7, 0, 1, 2}
+	k := NewGamepadKeypad(map[int]byte{0: 0x05, 1: 0x0A, 2: 0x20, 3: 0x02}, func() (int, error) {
+		if len(presses) == 0 {
+			return 0, ErrQuit
+		}
+		b := presses[0]
+		presses = presses[1:]
+		return b, nil
+	})
+
+	key, err := k.GetKey()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x02), key)
+
+	// Button 7 isn't mapped, so it's skipped.
+	key, err = k.GetKey()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x05), key)
+
+	key, err = k.GetKey()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x0A), key)
+
+	_, err = k.GetKey()
+	assert.Equal(t, &InvalidKey{Key: 0x20}, err)
+
+	_, err = k.GetKey()
+	assert.Equal(t, ErrQuit, err)
+}
+
+func TestTermboxKeypad_SpecialKeyMap(t *testing.T) {
+	events := []termbox.Event{
+		{Type: termbox.EventKey, Key: termbox.KeyArrowUp},
+		{Type: termbox.EventKey, Key: termbox.KeyArrowLeft},
+		{Type: termbox.EventKey, Ch: 'x'},
+		{Type: termbox.EventKey, Key: termbox.KeyArrowDown},
+		{Type: termbox.EventKey, Key: termbox.KeyArrowRight},
+		{Type: termbox.EventKey, Key: termbox.KeySpace},
+		{Type: termbox.EventKey, Key: termbox.KeyF1},
+	}
+	k := NewTermboxKeypad()
+	k.SpecialKeyMap = ArrowKeyMap
+	k.pollEvent = func() termbox.Event {
+		e := events[0]
+		events = events[1:]
+		return e
+	}
+
+	var got []byte
+	for i := 0; i < 6; i++ {
+		key, err := k.GetKey()
+		assert.NoError(t, err)
+		got = append(got, key)
+	}
+	assert.Equal(t, []byte{0x05, 0x07, 0x00, 0x08, 0x09, 0x06}, got)
+
+	_, err := k.GetKey()
+	assert.Error(t, err)
+}
+
+func TestTermboxKeypad_Hotkeys(t *testing.T) {
+	events := []termbox.Event{
+		{Type: termbox.EventKey, Key: termbox.KeyF12},
+		{Type: termbox.EventKey, Ch: 'w'},
+	}
+	k := NewTermboxKeypad()
+	var hits int
+	k.Hotkeys = map[termbox.Key]func(){
+		termbox.KeyF12: func() { hits++ },
+	}
+	k.pollEvent = func() termbox.Event {
+		e := events[0]
+		events = events[1:]
+		return e
+	}
+
+	// The hotkey runs and is skipped over, so it doesn't press a key.
+	key, err := k.GetKey()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x05), key)
+	assert.Equal(t, 1, hits)
+}
+
+func TestCPU_keypadErrors(t *testing.T) {
+	hiccup := errors.New("poll hiccup")
+	ft := newFakeTime()
+	newCPU := func() *CPU {
+		cpu := NewCPU(&Options{Timing: TimingFrom(ft)})
+		calls := 0
+		cpu.Keypad = KeypadFunc(func() (byte, error) {
+			calls++
+			if calls == 1 {
+				return 0, hiccup
+			}
+			return 0x0C, nil
+		})
+		cpu.LoadBytes([]byte{
+			0xF0, 0x0A, // LD V0, K
+			0x61, 0x01, // LD V1, 1
+			0x12, 0x04, // JP 0x204
+		})
+		return cpu
+	}
+
+	// By default the error is skipped and FX0A asks again.
+	cpu := newCPU()
+	go func() {
+		ft.Advance(time.Second)
+		cpu.Stop()
+	}()
+	assert.NoError(t, cpu.Run())
+	assert.Equal(t, byte(0x0C), cpu.V[0])
+	assert.Equal(t, byte(1), cpu.V[1])
+
+	// A handler can make it fatal.
+	cpu = newCPU()
+	var got error
+	cpu.SetKeypadErrorHandler(func(err error) bool {
+		got = err
+		return true
+	})
+	err := cpu.RunN(10)
+	assert.ErrorIs(t, err, hiccup)
+	assert.Equal(t, hiccup, got)
+	assert.Equal(t, byte(0), cpu.V[1])
+
+	// Without a keypad, no key will ever come.
+	cpu = NewCPU(nil)
+	cpu.Keypad = NullKeypad
+	assert.ErrorIs(t, cpu.ExecuteOpcode(0xF00A), ErrNoKeypad)
+}
+
+func TestTermboxKeypad_PollKeys(t *testing.T) {
+	events := make(chan termbox.Event)
+	ft := newFakeTime()
+	k := NewTermboxKeypad()
+	k.pollEvent = func() termbox.Event { return <-events }
+
+	cpu := NewCPU(&Options{Timing: TimingFrom(ft)})
+	cpu.Keypad = k
+	cpu.LoadBytes([]byte{
+		0x60, 0x05, // LD V0, 0x05
+		0xE0, 0x9E, // SKP V0
+		0x12, 0x02, // JP 0x202
+		0x12, 0x06, // JP 0x206
+	})
+	assert.NoError(t, cpu.RunN(5))
+	assert.NotEqual(t, uint16(0x206), cpu.ProgramCounter)
+
+	// W is held down, so SKP sees it while the game loops.
+	events <- termbox.Event{Type: termbox.EventKey, Ch: 'w'}
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, cpu.RunN(1))
+		return cpu.ProgramCounter == 0x206
+	}, time.Second, time.Millisecond)
+	assert.True(t, cpu.KeyState()[0x5])
+
+	// The terminal stops repeating it, so it is let go.
+	ft.now = ft.now.Add(DefaultKeyHold)
+	cpu.ProgramCounter = 0x202
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, uint16(0x204), cpu.ProgramCounter)
+	assert.False(t, cpu.KeyState()[0x5])
+
+	events <- termbox.Event{Type: termbox.EventKey, Ch: escapeKey}
+	assert.Eventually(t, func() bool {
+		return cpu.Step() == ErrQuit
+	}, time.Second, time.Millisecond)
+}
+
+func TestTermboxKeypad_PollKeysErrorBackoff(t *testing.T) {
+	// The terminal is gone and every read fails at once.
+	var reads atomic.Int32
+	k := NewTermboxKeypad()
+	k.pollEvent = func() termbox.Event {
+		reads.Add(1)
+		return termbox.Event{Type: termbox.EventError, Err: errors.New("tty gone")}
+	}
+
+	cpu := NewCPU(nil)
+	cpu.Keypad = k
+	cpu.LoadBytes([]byte{
+		0x12, 0x00, // JP 0x200
+	})
+
+	// The errors are skipped, but the reader waits longer after each one,
+	// 10ms, then 20ms, then 40ms, instead of spinning.
+	for deadline := time.Now().Add(50 * time.Millisecond); time.Now().Before(deadline); {
+		assert.NoError(t, cpu.RunN(100))
+	}
+	assert.LessOrEqual(t, reads.Load(), int32(4))
+	cpu.Stop()
+}
+
+func TestTermboxKeypad_PollKeysStopsWithRun(t *testing.T) {
+	events := make(chan termbox.Event, 1)
+	reading := make(chan struct{}, 1)
+	k := NewTermboxKeypad()
+	k.pollEvent = func() termbox.Event {
+		select {
+		case reading <- struct{}{}:
+		default:
+		}
+		return <-events
+	}
+
+	cpu := NewCPU(nil)
+	cpu.Keypad = k
+	cpu.LoadBytes([]byte{
+		0x12, 0x00, // JP 0x200
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- cpu.RunContext(ctx) }()
+	<-reading
+	cancel()
+	assert.NoError(t, <-done)
+	assert.True(t, k.feed.reading())
+
+	// The read under way can't be interrupted, but the reader stops after
+	// it rather than reading on.
+	events <- termbox.Event{Type: termbox.EventKey, Ch: 'w'}
+	assert.Eventually(t, func() bool {
+		return !k.feed.reading()
+	}, time.Second, time.Millisecond)
+
+	// Running again starts a new reader.
+	assert.NoError(t, cpu.RunN(1))
+	assert.True(t, k.feed.reading())
+	cpu.Stop()
+	events <- termbox.Event{Type: termbox.EventKey, Ch: 'w'}
+	assert.Eventually(t, func() bool {
+		return !k.feed.reading()
+	}, time.Second, time.Millisecond)
+}
+
+func TestCPU_SKPWithoutFeed(t *testing.T) {
+	// A Keypad that isn't a KeyPoller is asked for a key, as it was before
+	// keys could be fed.
+	cpu := NewCPU(nil)
+	cpu.Keypad = KeypadFunc(func() (byte, error) { return 0x05, nil })
+	cpu.V[0] = 0x05
+	assert.NoError(t, cpu.ExecuteOpcode(0xE09E))
+	assert.Equal(t, uint16(0x204), cpu.ProgramCounter)
+
+	// Without a keypad no key is pressed.
+	cpu = NewCPU(nil)
+	cpu.Keypad = NullKeypad
+	assert.NoError(t, cpu.ExecuteOpcode(0xE09E))
+	assert.Equal(t, uint16(0x202), cpu.ProgramCounter)
+}
+
+func TestCPU_LDVxKFed(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.Keypad = NullKeypad
+	cpu.LoadBytes([]byte{
+		0x00, 0xE0, // CLS
+		0xF0, 0x0A, // LD V0, K
+	})
+
+	// 3 goes down before FX0A runs, so FX0A waits for a new press.
+	cpu.PressKey(0x3)
+	assert.NoError(t, cpu.RunN(3))
+	assert.Equal(t, uint16(0x202), cpu.ProgramCounter)
+
+	cpu.PressKey(0x7)
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, uint16(0x204), cpu.ProgramCounter)
+	assert.Equal(t, byte(0x7), cpu.V[0])
+}
+
+func TestTermboxKeypad_HotkeysWhilePlaying(t *testing.T) {
+	events := make(chan termbox.Event, 1)
+	hits := make(chan int, 1)
+	k := NewTermboxKeypad()
+	k.pollEvent = func() termbox.Event { return <-events }
+	k.Hotkeys = map[termbox.Key]func(){
+		termbox.KeyF12: func() { hits <- 1 },
+	}
+
+	cpu := NewCPU(nil)
+	cpu.Keypad = k
+	cpu.LoadBytes([]byte{
+		0x12, 0x00, // JP 0x200
+	})
+
+	// The ROM never waits for a key, but the hotkey still runs.
+	events <- termbox.Event{Type: termbox.EventKey, Key: termbox.KeyF12}
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, cpu.RunN(1))
+		return len(hits) == 1
+	}, time.Second, time.Millisecond)
+}
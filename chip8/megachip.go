@@ -0,0 +1,132 @@
+package chip8
+
+// MegaChip resolution.
+const (
+	MegaChipWidth  = 256 // Pixels
+	MegaChipHeight = 192 // Pixels
+)
+
+// DefaultMegaSpriteSize is the width and height of sprites drawn by DXYN in
+// MegaChip mode until SPRW and SPRH change them. At one byte per pixel it
+// is 64 bytes, small enough to draw from anywhere in the default memory.
+const DefaultMegaSpriteSize = 8
+
+// megaChip is the state of the MegaChip extension.
+type megaChip struct {
+	// enabled is set while the CPU is in MegaChip mode.
+	enabled bool
+
+	// spriteWidth and spriteHeight are the size of sprites drawn by DXYN
+	// in MegaChip mode.
+	spriteWidth, spriteHeight int
+}
+
+// registerMegaChip adds the MegaChip opcodes to the CPU.
+func (c *CPU) registerMegaChip() {
+	c.mega = megaChip{spriteWidth: DefaultMegaSpriteSize, spriteHeight: DefaultMegaSpriteSize}
+	c.RegisterOpcode(0xFFFF, 0x0010, (*CPU).opMegaOff)
+	c.RegisterOpcode(0xFFFF, 0x0011, (*CPU).opMegaOn)
+	c.RegisterOpcode(0xFF00, 0x0300, (*CPU).opSPRW)
+	c.RegisterOpcode(0xFF00, 0x0400, (*CPU).opSPRH)
+	c.RegisterOpcode(0xFFF0, 0x0600, (*CPU).opMegaAudio)
+	c.RegisterOpcode(0xFFFF, 0x0700, (*CPU).opMegaAudio)
+	c.RegisterOpcode(0xF000, 0xD000, (*CPU).opMegaDRW)
+}
+
+// MegaChip reports whether the CPU is in MegaChip mode.
+func (c *CPU) MegaChip() bool {
+	return c.mega.enabled
+}
+
+// 0010	Disables MegaChip mode, returning to the CHIP-8 resolution.
+func (c *CPU) opMegaOff(opcode uint16) error {
+	c.mega.enabled = false
+	c.setResolution(GraphicsWidth, GraphicsHeight)
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 0011	Enables MegaChip mode at 256x192.
+func (c *CPU) opMegaOn(opcode uint16) error {
+	c.mega.enabled = true
+	c.setResolution(MegaChipWidth, MegaChipHeight)
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 03NN	Sets the sprite width to NN. 0 means 256.
+func (c *CPU) opSPRW(opcode uint16) error {
+	c.mega.spriteWidth = megaSpriteSize(opcode)
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 04NN	Sets the sprite height to NN. 0 means 256.
+func (c *CPU) opSPRH(opcode uint16) error {
+	c.mega.spriteHeight = megaSpriteSize(opcode)
+	c.ProgramCounter += 2
+	return nil
+}
+
+func megaSpriteSize(opcode uint16) int {
+	if n := int(opcode & 0x00FF); n != 0 {
+		return n
+	}
+	return 256
+}
+
+// 060N, 0700	Start and stop sound. Sound isn't supported, so these do
+// nothing.
+func (c *CPU) opMegaAudio(opcode uint16) error {
+	c.ProgramCounter += 2
+	return nil
+}
+
+// DXYN	In MegaChip mode, draws a sprite of the configured width and height
+// at (VX, VY). The sprite is one byte per pixel, and every non-zero byte
+// turns its pixel on. Pixels off the screen are clipped. VF is set to 1 if
+// a pixel was already on, and 0 otherwise. Outside MegaChip mode this is
+// the CHIP-8 DXYN.
+func (c *CPU) opMegaDRW(opcode uint16) error {
+	if !c.mega.enabled {
+		return c.opDRW(opcode)
+	}
+
+	w, h := c.mega.spriteWidth, c.mega.spriteHeight
+	if err := c.checkAddress(c.I, w*h); err != nil {
+		return err
+	}
+	x0 := int(c.V[(opcode&0x0F00)>>8])
+	y0 := int(c.V[(opcode&0x00F0)>>4])
+
+	var cf byte
+	sprite := c.Memory[c.I:]
+	for row := 0; row < h; row++ {
+		y := y0 + row
+		if y >= c.Graphics.Height() {
+			break
+		}
+		for col := 0; col < w; col++ {
+			x := x0 + col
+			if x >= c.Graphics.Width() {
+				break
+			}
+			if sprite[row*w+col] == 0 {
+				continue
+			}
+			if c.Graphics.GetPixel(uint16(x), uint16(y)) {
+				cf = 0x01
+				continue
+			}
+			c.Graphics.Set(uint16(x), uint16(y), true)
+		}
+	}
+	if cf != 0 {
+		c.collisions++
+	}
+
+	c.V[0xF] = cf
+	c.ProgramCounter += 2
+	c.draw()
+	return nil
+}
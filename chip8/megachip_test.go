@@ -0,0 +1,112 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPU_MegaChipDisabled(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{0x00, 0x11})
+
+	assert.Equal(t, &ExecutionError{PC: 0x200, Opcode: 0x0011, Err: &UnknownOpcode{Opcode: 0x0011}}, cpu.RunN(1))
+	assert.False(t, cpu.MegaChip())
+}
+
+func TestCPU_MegaChipMode(t *testing.T) {
+	cpu := NewCPU(&Options{MegaChip: true})
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{
+		0x00, 0x11, // MEGAON
+		0x00, 0x10, // MEGAOFF
+	})
+
+	assert.Equal(t, GraphicsWidth, cpu.Graphics.Width())
+	assert.Equal(t, GraphicsHeight, cpu.Graphics.Height())
+
+	assert.NoError(t, cpu.RunN(1))
+	assert.True(t, cpu.MegaChip())
+	assert.Equal(t, MegaChipWidth, cpu.Graphics.Width())
+	assert.Equal(t, MegaChipHeight, cpu.Graphics.Height())
+
+	assert.NoError(t, cpu.RunN(1))
+	assert.False(t, cpu.MegaChip())
+	assert.Equal(t, GraphicsWidth, cpu.Graphics.Width())
+	assert.Equal(t, GraphicsHeight, cpu.Graphics.Height())
+}
+
+func TestCPU_MegaChipSpriteSize(t *testing.T) {
+	cpu := NewCPU(&Options{MegaChip: true})
+	cpu.LoadBytes([]byte{
+		0x03, 0x10, // SPRW 0x10
+		0x04, 0x00, // SPRH 0x00
+		0x06, 0x01, // audio, ignored
+		0x07, 0x00, // audio, ignored
+	})
+
+	assert.NoError(t, cpu.RunN(4))
+	assert.Equal(t, 16, cpu.mega.spriteWidth)
+	assert.Equal(t, 256, cpu.mega.spriteHeight)
+	assert.Equal(t, uint16(0x208), cpu.ProgramCounter)
+}
+
+func TestCPU_MegaChipDraw(t *testing.T) {
+	cpu := NewCPU(&Options{MegaChip: true})
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{
+		0x00, 0x11, // MEGAON
+		0x03, 0x02, // SPRW 2
+		0x04, 0x02, // SPRH 2
+		0xA3, 0x00, // LD I, 0x300
+		0x60, 0xFF, // LD V0, 0xFF
+		0x61, 0x64, // LD V1, 100
+		0xD0, 0x10, // DRW V0, V1
+		0xD0, 0x10, // DRW V0, V1
+	})
+	copy(cpu.Memory[0x300:], []byte{
+		0x05, 0x00,
+		0x00, 0x07,
+	})
+
+	assert.NoError(t, cpu.RunN(7))
+	assert.True(t, cpu.Graphics.GetPixel(255, 100))
+	assert.False(t, cpu.Graphics.GetPixel(255, 101))
+	assert.Equal(t, byte(0), cpu.V[0xF])
+	// The second column is off the screen and clipped, not wrapped.
+	assert.False(t, cpu.Graphics.GetPixel(0, 101))
+
+	// Drawing again leaves the pixels on and reports the collision.
+	assert.NoError(t, cpu.RunN(1))
+	assert.True(t, cpu.Graphics.GetPixel(255, 100))
+	assert.Equal(t, byte(1), cpu.V[0xF])
+}
+
+func TestCPU_MegaChipDrawDefaultSize(t *testing.T) {
+	cpu := NewCPU(&Options{MegaChip: true})
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{
+		0x00, 0x11, // MEGAON
+		0xA3, 0x00, // LD I, 0x300
+		0xD0, 0x00, // DRW V0, V0
+	})
+	cpu.Memory[0x300+DefaultMegaSpriteSize*DefaultMegaSpriteSize-1] = 0x01
+
+	assert.NoError(t, cpu.RunN(3))
+	assert.True(t, cpu.Graphics.GetPixel(DefaultMegaSpriteSize-1, DefaultMegaSpriteSize-1))
+	assert.Equal(t, 1, cpu.Graphics.CountOnPixels())
+}
+
+func TestCPU_MegaChipDrawOutsideMegaMode(t *testing.T) {
+	cpu := NewCPU(&Options{MegaChip: true})
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{
+		0xA0, 0x00, // LD I, 0x000 (font 0)
+		0xD0, 0x05, // DRW V0, V0, 5
+	})
+
+	assert.NoError(t, cpu.RunN(2))
+	assert.True(t, cpu.Graphics.GetPixel(0, 0))
+	assert.True(t, cpu.Graphics.GetPixel(3, 0))
+	assert.False(t, cpu.Graphics.GetPixel(4, 0))
+}
@@ -0,0 +1,271 @@
+// Package monitor implements an interactive machine-code monitor for the
+// CHIP-8 CPU: a prompt for stepping through a program, setting breakpoints
+// and inspecting registers and memory.
+package monitor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/scottjab/go-chip8/chip8"
+)
+
+// MaxContinue bounds the number of instructions "continue" executes
+// without hitting a breakpoint, so a program that never reaches one
+// doesn't hang the monitor.
+var MaxContinue = 1000000
+
+// Command is a parsed monitor command.
+type Command struct {
+	// Name is the full name of the command, e.g. "step" for "s".
+	Name string
+
+	// Args are the command's arguments. Addresses are parsed as hex and
+	// counts as decimal.
+	Args []int
+}
+
+type argKind int
+
+const (
+	addrArg argKind = iota
+	countArg
+)
+
+// commandSpec describes the arguments a command takes. The first required
+// arguments must be given, the rest are optional.
+type commandSpec struct {
+	args     []argKind
+	required int
+	help     string
+}
+
+var commands = map[string]commandSpec{
+	"step":     {[]argKind{countArg}, 0, "step [n]          execute n instructions (default 1)"},
+	"continue": {nil, 0, "continue          run until a breakpoint"},
+	"regs":     {nil, 0, "regs              show the registers"},
+	"mem":      {[]argKind{addrArg, countArg}, 1, "mem addr [n]      dump n bytes of memory (default 16)"},
+	"break":    {[]argKind{addrArg}, 0, "break [addr]      toggle a breakpoint, or list them"},
+	"disasm":   {[]argKind{addrArg, countArg}, 1, "disasm addr [n]   disassemble n instructions (default 8)"},
+	"screen":   {nil, 0, "screen            show the screen"},
+	"help":     {nil, 0, "help              show this help"},
+	"quit":     {nil, 0, "quit              leave the monitor"},
+}
+
+var aliases = map[string]string{
+	"s": "step",
+	"c": "continue",
+	"r": "regs",
+	"m": "mem",
+	"b": "break",
+	"d": "disasm",
+	"q": "quit",
+}
+
+// ParseCommand parses a line typed at the prompt.
+func ParseCommand(line string) (Command, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return Command{}, errors.New("empty command")
+	}
+
+	name := strings.ToLower(fields[0])
+	if full, ok := aliases[name]; ok {
+		name = full
+	}
+	spec, ok := commands[name]
+	if !ok {
+		return Command{}, fmt.Errorf("unknown command %q", fields[0])
+	}
+
+	args := fields[1:]
+	if len(args) < spec.required || len(args) > len(spec.args) {
+		return Command{}, fmt.Errorf("usage: %s", spec.help)
+	}
+	cmd := Command{Name: name, Args: make([]int, len(args))}
+	for i, a := range args {
+		var (
+			v   int64
+			err error
+		)
+		switch spec.args[i] {
+		case addrArg:
+			v, err = strconv.ParseInt(strings.TrimPrefix(strings.ToLower(a), "0x"), 16, 32)
+		case countArg:
+			v, err = strconv.ParseInt(a, 10, 32)
+		}
+		if err != nil || v < 0 {
+			return Command{}, fmt.Errorf("invalid argument %q", a)
+		}
+		cmd.Args[i] = int(v)
+	}
+	return cmd, nil
+}
+
+// Monitor drives a CPU with monitor commands.
+type Monitor struct {
+	cpu         *chip8.CPU
+	out         io.Writer
+	breakpoints map[uint16]bool
+}
+
+// New returns a Monitor for cpu that writes its output to out.
+func New(cpu *chip8.CPU, out io.Writer) *Monitor {
+	return &Monitor{
+		cpu:         cpu,
+		out:         out,
+		breakpoints: make(map[uint16]bool),
+	}
+}
+
+// ErrQuit is returned by Exec for the quit command.
+var ErrQuit = errors.New("monitor: quit")
+
+// Run reads commands from in until it is exhausted or the quit command is
+// given. Errors from commands are reported and don't stop the monitor.
+func (m *Monitor) Run(in io.Reader) error {
+	s := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(m.out, "> ")
+		if !s.Scan() {
+			return s.Err()
+		}
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		cmd, err := ParseCommand(s.Text())
+		if err == nil {
+			err = m.Exec(cmd)
+		}
+		if err == ErrQuit {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(m.out, "error: %s\n", err)
+		}
+	}
+}
+
+// Exec executes a single command.
+func (m *Monitor) Exec(cmd Command) error {
+	c := m.cpu
+	switch cmd.Name {
+	case "step":
+		n := arg(cmd, 0, 1)
+		for i := 0; i < n; i++ {
+			m.printInstruction(c.ProgramCounter)
+			if err := c.Step(); err != nil {
+				return err
+			}
+		}
+	case "continue":
+		for i := 0; i < MaxContinue; i++ {
+			if err := c.Step(); err != nil {
+				return err
+			}
+			if m.breakpoints[c.ProgramCounter] {
+				fmt.Fprintf(m.out, "breakpoint at %04X\n", c.ProgramCounter)
+				m.printInstruction(c.ProgramCounter)
+				return nil
+			}
+		}
+		return fmt.Errorf("no breakpoint hit in %d instructions", MaxContinue)
+	case "regs":
+		fmt.Fprintf(m.out, "PC:%04X I:%04X SP:%02X DT:%02X ST:%02X\n",
+			c.ProgramCounter, c.I, c.StackPointer, c.DelayTimer, c.SoundTimer)
+		for i, v := range c.V {
+			sep := " "
+			if i%8 == 7 {
+				sep = "\n"
+			}
+			fmt.Fprintf(m.out, "V%X:%02X%s", i, v, sep)
+		}
+	case "mem":
+		addr, n := cmd.Args[0], arg(cmd, 1, 16)
+		b, err := m.memory(addr, n)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(b); i += 16 {
+			fmt.Fprintf(m.out, "%04X: % X\n", addr+i, b[i:min(i+16, len(b))])
+		}
+	case "break":
+		if len(cmd.Args) == 0 {
+			addrs := make([]int, 0, len(m.breakpoints))
+			for a := range m.breakpoints {
+				addrs = append(addrs, int(a))
+			}
+			sort.Ints(addrs)
+			for _, a := range addrs {
+				fmt.Fprintf(m.out, "%04X\n", a)
+			}
+			return nil
+		}
+		addr := uint16(cmd.Args[0])
+		if m.breakpoints[addr] {
+			delete(m.breakpoints, addr)
+			fmt.Fprintf(m.out, "breakpoint at %04X cleared\n", addr)
+		} else {
+			m.breakpoints[addr] = true
+			fmt.Fprintf(m.out, "breakpoint at %04X set\n", addr)
+		}
+	case "disasm":
+		addr, n := cmd.Args[0], arg(cmd, 1, 8)
+		b, err := m.memory(addr, 2*n)
+		if err != nil {
+			return err
+		}
+		for _, in := range chip8.Disassemble(b, uint16(addr)) {
+			fmt.Fprintln(m.out, in)
+		}
+	case "screen":
+		fmt.Fprint(m.out, c.Graphics.String())
+	case "help":
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(m.out, commands[name].help)
+		}
+	case "quit":
+		return ErrQuit
+	default:
+		return fmt.Errorf("unknown command %q", cmd.Name)
+	}
+	return nil
+}
+
+// printInstruction prints the disassembled instruction at addr.
+func (m *Monitor) printInstruction(addr uint16) {
+	b, err := m.memory(int(addr), 2)
+	if err != nil || len(b) < 2 {
+		fmt.Fprintf(m.out, "%04X: ????\n", addr)
+		return
+	}
+	fmt.Fprintln(m.out, chip8.Disassemble(b, addr)[0])
+}
+
+// memory returns the n bytes of memory at addr, clipped to the end of
+// memory.
+func (m *Monitor) memory(addr, n int) ([]byte, error) {
+	mem := m.cpu.Memory
+	if addr >= len(mem) {
+		return nil, &chip8.AddressError{Address: addr}
+	}
+	return mem[addr:min(addr+n, len(mem))], nil
+}
+
+// arg returns argument i of cmd, or def if it wasn't given.
+func arg(cmd Command, i, def int) int {
+	if i < len(cmd.Args) {
+		return cmd.Args[i]
+	}
+	return def
+}
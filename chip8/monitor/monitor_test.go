@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/scottjab/go-chip8/chip8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		want Command
+		err  string
+	}{
+		{"step", Command{Name: "step", Args: []int{}}, ""},
+		{"  s 10 ", Command{Name: "step", Args: []int{10}}, ""},
+		{"mem 200", Command{Name: "mem", Args: []int{0x200}}, ""},
+		{"MEM 0x2A0 32", Command{Name: "mem", Args: []int{0x2A0, 32}}, ""},
+		{"b 20C", Command{Name: "break", Args: []int{0x20C}}, ""},
+		{"disasm 200 4", Command{Name: "disasm", Args: []int{0x200, 4}}, ""},
+		{"c", Command{Name: "continue", Args: []int{}}, ""},
+		{"", Command{}, "empty command"},
+		{"jump 200", Command{}, `unknown command "jump"`},
+		{"mem", Command{}, "usage: mem addr [n]      dump n bytes of memory (default 16)"},
+		{"regs 1", Command{}, "usage: regs              show the registers"},
+		{"mem xyz", Command{}, `invalid argument "xyz"`},
+		{"step 0x10", Command{}, `invalid argument "0x10"`},
+		{"step -1", Command{}, `invalid argument "-1"`},
+	}
+	for _, tt := range tests {
+		cmd, err := ParseCommand(tt.line)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.line)
+			continue
+		}
+		assert.NoError(t, err, tt.line)
+		assert.Equal(t, tt.want, cmd, tt.line)
+	}
+}
+
+func newCPU() *chip8.CPU {
+	cpu := chip8.NewCPU(nil)
+	cpu.Graphics.Display = chip8.NullDisplay
+	cpu.LoadBytes([]byte{
+		0x60, 0x05, // LD V0, 0x05
+		0x70, 0x01, // ADD V0, 0x01
+		0x12, 0x02, // JP 0x202
+	})
+	return cpu
+}
+
+func TestMonitor_Run(t *testing.T) {
+	cpu := newCPU()
+	var out bytes.Buffer
+	m := New(cpu, &out)
+
+	err := m.Run(strings.NewReader(strings.Join([]string{
+		"step",
+		"break 204",
+		"continue",
+		"regs",
+		"mem 200 6",
+		"disasm 200 2",
+		"bogus",
+		"quit",
+		"step",
+	}, "\n")))
+	assert.NoError(t, err)
+
+	assert.Equal(t, strings.Join([]string{
+		"> 0200: 6005  LD V0, 0x05",
+		"> breakpoint at 0204 set",
+		"> breakpoint at 0204",
+		"0204: 1202  JP 0x202",
+		"> PC:0204 I:0000 SP:00 DT:00 ST:00",
+		"V0:06 V1:00 V2:00 V3:00 V4:00 V5:00 V6:00 V7:00",
+		"V8:00 V9:00 VA:00 VB:00 VC:00 VD:00 VE:00 VF:00",
+		"> 0200: 60 05 70 01 12 02",
+		"> 0200: 6005  LD V0, 0x05",
+		"0202: 7001  ADD V0, 0x01",
+		`> error: unknown command "bogus"`,
+		"> ",
+	}, "\n"), out.String())
+	// Quitting leaves the rest of the input alone.
+	assert.Equal(t, uint16(0x204), cpu.ProgramCounter)
+}
+
+func TestMonitor_continueWithoutBreakpoint(t *testing.T) {
+	defer func(n int) { MaxContinue = n }(MaxContinue)
+	MaxContinue = 10
+
+	m := New(newCPU(), &bytes.Buffer{})
+	assert.EqualError(t, m.Exec(Command{Name: "continue"}), "no breakpoint hit in 10 instructions")
+}
+
+func TestMonitor_memOutOfRange(t *testing.T) {
+	m := New(newCPU(), &bytes.Buffer{})
+	assert.Equal(t, &chip8.AddressError{Address: 0x1000}, m.Exec(Command{Name: "mem", Args: []int{0x1000}}))
+}
@@ -0,0 +1,651 @@
+package chip8
+
+import (
+	"math/rand"
+	"slices"
+)
+
+// OpcodeFunc executes a single opcode against the CPU. It is responsible for
+// advancing the program counter.
+type OpcodeFunc func(c *CPU, opcode uint16) error
+
+// opcodeHandler executes the opcodes for which opcode&mask == pattern.
+type opcodeHandler struct {
+	mask, pattern uint16
+	fn            OpcodeFunc
+}
+
+// OpcodeSpec describes an opcode the CPU implements.
+type OpcodeSpec struct {
+	// Mask and Pattern select the opcodes: those for which
+	// opcode&Mask == Pattern.
+	Mask, Pattern uint16
+
+	// Mnemonic is the assembly mnemonic, e.g. "DRW".
+	Mnemonic string
+
+	// Syntax is the assembly syntax of the instruction, with the operands
+	// as placeholders: {x} and {y} for register numbers, {n} for a nibble,
+	// {nn} for a byte and {nnn} for an address.
+	Syntax string
+
+	// Description says what the instruction does.
+	Description string
+}
+
+// builtinOpcode is an opcode implemented by the CPU.
+type builtinOpcode struct {
+	spec OpcodeSpec
+	fn   OpcodeFunc
+}
+
+// builtinOpcodes are the CHIP-8 opcodes implemented by the CPU. Dispatch
+// works from this list.
+var builtinOpcodes = []builtinOpcode{
+	{OpcodeSpec{0xFFFF, 0x00E0, "CLS", "CLS", "Clear the screen."}, (*CPU).opCLS},
+	{OpcodeSpec{0xFFFF, 0x00EE, "RET", "RET", "Return from a subroutine."}, (*CPU).opRET},
+	{OpcodeSpec{0xF000, 0x1000, "JP", "JP {nnn}", "Jump to NNN."}, (*CPU).opJP},
+	{OpcodeSpec{0xF000, 0x2000, "CALL", "CALL {nnn}", "Call the subroutine at NNN."}, (*CPU).opCALL},
+	{OpcodeSpec{0xF000, 0x3000, "SE", "SE V{x}, {nn}", "Skip the next instruction if VX == NN."}, (*CPU).opSEByte},
+	{OpcodeSpec{0xF000, 0x4000, "SNE", "SNE V{x}, {nn}", "Skip the next instruction if VX != NN."}, (*CPU).opSNEByte},
+	{OpcodeSpec{0xF00F, 0x5000, "SE", "SE V{x}, V{y}", "Skip the next instruction if VX == VY."}, (*CPU).opSE},
+	{OpcodeSpec{0xF000, 0x6000, "LD", "LD V{x}, {nn}", "Set VX to NN."}, (*CPU).opLDByte},
+	{OpcodeSpec{0xF000, 0x7000, "ADD", "ADD V{x}, {nn}", "Add NN to VX, leaving VF alone."}, (*CPU).opADDByte},
+	{OpcodeSpec{0xF00F, 0x8000, "LD", "LD V{x}, V{y}", "Set VX to VY."}, (*CPU).opLD},
+	{OpcodeSpec{0xF00F, 0x8001, "OR", "OR V{x}, V{y}", "Set VX to VX OR VY."}, (*CPU).opOR},
+	{OpcodeSpec{0xF00F, 0x8002, "AND", "AND V{x}, V{y}", "Set VX to VX AND VY."}, (*CPU).opAND},
+	{OpcodeSpec{0xF00F, 0x8003, "XOR", "XOR V{x}, V{y}", "Set VX to VX XOR VY."}, (*CPU).opXOR},
+	{OpcodeSpec{0xF00F, 0x8004, "ADD", "ADD V{x}, V{y}", "Add VY to VX. VF is set to the carry."}, (*CPU).opADD},
+	{OpcodeSpec{0xF00F, 0x8005, "SUB", "SUB V{x}, V{y}", "Subtract VY from VX. VF is set to 0 on a borrow, 1 otherwise."}, (*CPU).opSUB},
+	{OpcodeSpec{0xF00F, 0x8006, "SHR", "SHR V{x}, V{y}", "Shift VX right by one. VF is set to the bit shifted out."}, (*CPU).opSHR},
+	{OpcodeSpec{0xF00F, 0x8007, "SUBN", "SUBN V{x}, V{y}", "Set VX to VY minus VX. VF is set to 0 on a borrow, 1 otherwise."}, (*CPU).opSUBN},
+	{OpcodeSpec{0xF00F, 0x800E, "SHL", "SHL V{x}, V{y}", "Shift VX left by one. VF is set to the bit shifted out."}, (*CPU).opSHL},
+	{OpcodeSpec{0xF00F, 0x9000, "SNE", "SNE V{x}, V{y}", "Skip the next instruction if VX != VY."}, (*CPU).opSNE},
+	{OpcodeSpec{0xF000, 0xA000, "LD", "LD I, {nnn}", "Set I to NNN."}, (*CPU).opLDI},
+	{OpcodeSpec{0xF000, 0xB000, "JP", "JP V0, {nnn}", "Jump to NNN plus V0."}, (*CPU).opJPV0},
+	{OpcodeSpec{0xF000, 0xC000, "RND", "RND V{x}, {nn}", "Set VX to a random number AND NN."}, (*CPU).opRND},
+	{OpcodeSpec{0xF000, 0xD000, "DRW", "DRW V{x}, V{y}, {n}", "Draw the N byte sprite at I at (VX, VY). VF is set on a collision."}, (*CPU).opDRW},
+	{OpcodeSpec{0xF0FF, 0xE09E, "SKP", "SKP V{x}", "Skip the next instruction if the key in VX is pressed."}, (*CPU).opSKP},
+	{OpcodeSpec{0xF0FF, 0xE0A1, "SKNP", "SKNP V{x}", "Skip the next instruction if the key in VX isn't pressed."}, (*CPU).opSKNP},
+	{OpcodeSpec{0xF0FF, 0xF007, "LD", "LD V{x}, DT", "Set VX to the delay timer."}, (*CPU).opLDVxDT},
+	{OpcodeSpec{0xF0FF, 0xF00A, "LD", "LD V{x}, K", "Wait for a key press and store the key in VX."}, (*CPU).opLDVxK},
+	{OpcodeSpec{0xF0FF, 0xF015, "LD", "LD DT, V{x}", "Set the delay timer to VX."}, (*CPU).opLDDTVx},
+	{OpcodeSpec{0xF0FF, 0xF018, "LD", "LD ST, V{x}", "Set the sound timer to VX."}, (*CPU).opLDSTVx},
+	{OpcodeSpec{0xF0FF, 0xF01E, "ADD", "ADD I, V{x}", "Add VX to I."}, (*CPU).opADDI},
+	{OpcodeSpec{0xF0FF, 0xF029, "LD", "LD F, V{x}", "Set I to the font sprite for the digit in VX."}, (*CPU).opLDF},
+	{OpcodeSpec{0xF0FF, 0xF033, "LD", "LD B, V{x}", "Store the BCD of VX at I, I+1 and I+2."}, (*CPU).opLDB},
+	{OpcodeSpec{0xF0FF, 0xF055, "LD", "LD [I], V{x}", "Store V0 to VX in memory starting at I."}, (*CPU).opLDIVx},
+	{OpcodeSpec{0xF0FF, 0xF065, "LD", "LD V{x}, [I]", "Load V0 to VX from memory starting at I."}, (*CPU).opLDVxI},
+}
+
+// schipOpcodes are the SUPER-CHIP opcodes. The CPU only executes them when
+// registerSCHIP has added them, so that a plain CHIP-8 program reaching one
+// gets an UnknownOpcode rather than a new resolution.
+var schipOpcodes = []builtinOpcode{
+	{OpcodeSpec{0xFFFF, 0x00FE, "LOW", "LOW", "Switch to the 64x32 low resolution."}, (*CPU).opLOW},
+	{OpcodeSpec{0xFFFF, 0x00FF, "HIGH", "HIGH", "Switch to the 128x64 high resolution."}, (*CPU).opHIGH},
+	{OpcodeSpec{0xF0FF, 0xF030, "LD", "LD HF, V{x}", "Set I to the big font sprite for the digit in VX."}, (*CPU).opLDHF},
+}
+
+// xochipOpcodes are the XO-CHIP opcodes, which the CPU only executes when
+// registerXOCHIP has added them.
+var xochipOpcodes = []builtinOpcode{
+	{OpcodeSpec{0xF0FF, 0xF001, "PLANE", "PLANE {x}", "Select the planes drawn to, as a bit mask in X."}, (*CPU).opPLANE},
+	{OpcodeSpec{0xFFFF, 0xF002, "AUDIO", "AUDIO", "Load the 16 byte audio pattern at I into the audio buffer."}, (*CPU).opAUDIO},
+	{OpcodeSpec{0xF0FF, 0xF03A, "PITCH", "PITCH V{x}", "Set the audio playback pitch to VX."}, (*CPU).opPITCH},
+}
+
+// knownOpcodes are all the opcodes the disassembler and assembler know,
+// whether or not a CPU executes them.
+var knownOpcodes = slices.Concat(builtinOpcodes, schipOpcodes, xochipOpcodes)
+
+// SupportedOpcodes returns a description of every opcode the CPU
+// implements, not counting opcodes added with RegisterOpcode or by options
+// such as MegaChip. The SUPER-CHIP and XO-CHIP opcodes are included, though
+// they are only executed under their presets.
+func SupportedOpcodes() []OpcodeSpec {
+	specs := make([]OpcodeSpec, len(knownOpcodes))
+	for i, op := range knownOpcodes {
+		specs[i] = op.spec
+	}
+	return specs
+}
+
+// opcodeTable holds builtinOpcodes keyed by the high nibble of the opcode,
+// for dispatch, and knownOpcodeTable holds knownOpcodes the same way, for
+// the disassembler.
+var (
+	opcodeTable      = indexOpcodes(builtinOpcodes)
+	knownOpcodeTable = indexOpcodes(knownOpcodes)
+)
+
+func indexOpcodes(ops []builtinOpcode) (t [16][]builtinOpcode) {
+	for _, op := range ops {
+		n := op.spec.Pattern >> 12
+		t[n] = append(t[n], op)
+	}
+	return
+}
+
+// lookupOpcode returns the opcode in table matching opcode.
+func lookupOpcode(table *[16][]builtinOpcode, opcode uint16) (builtinOpcode, bool) {
+	for _, op := range table[opcode>>12] {
+		if opcode&op.spec.Mask == op.spec.Pattern {
+			return op, true
+		}
+	}
+	return builtinOpcode{}, false
+}
+
+// RegisterOpcode makes the CPU execute handler for every opcode for which
+// opcode&mask == pattern. Registered opcodes take precedence over the
+// built-in ones, and later registrations over earlier ones, so this can also
+// replace a built-in opcode.
+func (c *CPU) RegisterOpcode(mask, pattern uint16, handler OpcodeFunc) {
+	c.opcodes = append(c.opcodes, opcodeHandler{mask, pattern, handler})
+}
+
+// ExecuteOpcode executes a single opcode against the current state of the
+// CPU, as if it had been fetched from the program counter. Nothing is read
+// from memory at the program counter.
+func (c *CPU) ExecuteOpcode(opcode uint16) error {
+	return c.dispatch(opcode)
+}
+
+func (c *CPU) dispatch(opcode uint16) error {
+	if c.history != nil {
+		c.history.push(c)
+	}
+	c.presses = c.takePresses()
+	for i := len(c.opcodes) - 1; i >= 0; i-- {
+		if h := c.opcodes[i]; opcode&h.mask == h.pattern {
+			c.profile(h.pattern)
+			return h.fn(c, opcode)
+		}
+	}
+	if op, ok := lookupOpcode(&opcodeTable, opcode); ok {
+		c.profile(op.spec.Pattern)
+		return op.fn(c, opcode)
+	}
+	return &UnknownOpcode{Opcode: opcode}
+}
+
+// profile counts an instruction with the given pattern in the histogram.
+func (c *CPU) profile(pattern uint16) {
+	if c.histogram != nil {
+		c.histogram[pattern]++
+	}
+}
+
+// 00E0 Clears the screen.
+func (c *CPU) opCLS(opcode uint16) error {
+	c.Graphics.Clear()
+	c.ProgramCounter += 2
+	c.draw()
+	return nil
+}
+
+// 00EE Return from subroutine.
+func (c *CPU) opRET(opcode uint16) error {
+	// Subtract one from the stack pointer, then
+	// set the program counter to the address
+	// it points at.
+	if c.StackPointer == 0 {
+		if err := c.stackError(false); err != nil {
+			return err
+		}
+		c.ProgramCounter += 2
+		return nil
+	}
+
+	c.StackPointer--
+	c.ProgramCounter = c.Stack[c.StackPointer]
+
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 1NNN JUMP to location nnn
+func (c *CPU) opJP(opcode uint16) error {
+	c.ProgramCounter = opcode & 0x0FFF
+	return nil
+}
+
+// 2NNN CALL subroutine at nnn
+func (c *CPU) opCALL(opcode uint16) error {
+	if int(c.StackPointer) >= len(c.Stack) {
+		if err := c.stackError(true); err != nil {
+			return err
+		}
+		c.StackPointer--
+	}
+	c.Stack[c.StackPointer] = c.ProgramCounter
+	c.StackPointer++
+	c.ProgramCounter = opcode & 0x0FFF
+	return nil
+}
+
+// 3XNN Skips the next instruction if VX equals NN.
+func (c *CPU) opSEByte(opcode uint16) error {
+	reg := (opcode & 0x0F00) >> 8
+	nn := byte(opcode)
+	c.ProgramCounter += 2
+	if c.V[reg] == nn {
+		c.ProgramCounter += 2
+	}
+	return nil
+}
+
+// 4XNN Skips the next instruction if VX doesn't equal NN.
+func (c *CPU) opSNEByte(opcode uint16) error {
+	reg := (opcode & 0x0F00) >> 8
+	nn := byte(opcode)
+	c.ProgramCounter += 2
+	if c.V[reg] != nn {
+		c.ProgramCounter += 2
+	}
+	return nil
+}
+
+// 5XY0 Skips the next instruction if VX equals VY.
+func (c *CPU) opSE(opcode uint16) error {
+	x, y := xy(opcode)
+	c.ProgramCounter += 2
+	if c.V[x] == c.V[y] {
+		c.ProgramCounter += 2
+	}
+	return nil
+}
+
+// 6XNN	Sets VX to NN.
+func (c *CPU) opLDByte(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	nn := byte(opcode)
+	c.ProgramCounter += 2
+	c.V[x] = nn
+	return nil
+}
+
+// 7XNN	Adds NN to VX.
+func (c *CPU) opADDByte(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	kk := byte(opcode)
+	c.V[x] = c.V[x] + kk
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 8XY0	Sets VX to the value of VY.
+func (c *CPU) opLD(opcode uint16) error {
+	x, y := xy(opcode)
+	c.V[x] = c.V[y]
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 8XY1	Sets VX to VX or VY.
+func (c *CPU) opOR(opcode uint16) error {
+	x, y := xy(opcode)
+	c.V[x] = c.V[y] | c.V[x]
+	if c.Quirks.VFResetOnLogic {
+		c.V[0xF] = 0
+	}
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 8XY2	Sets VX to VX and VY.
+func (c *CPU) opAND(opcode uint16) error {
+	x, y := xy(opcode)
+	c.V[x] = c.V[y] & c.V[x]
+	if c.Quirks.VFResetOnLogic {
+		c.V[0xF] = 0
+	}
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 8XY3	Sets VX to VX xor VY.
+func (c *CPU) opXOR(opcode uint16) error {
+	x, y := xy(opcode)
+	c.V[x] = c.V[y] ^ c.V[x]
+	if c.Quirks.VFResetOnLogic {
+		c.V[0xF] = 0
+	}
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 8XY4	Adds VY to VX.
+// VF is set to 1 when there's a carry,
+// and to 0 when there isn't.
+func (c *CPU) opADD(opcode uint16) error {
+	x, y := xy(opcode)
+	result := uint16(c.V[x]) + uint16(c.V[y])
+
+	var cf byte
+	if result > 0xFF {
+		cf = 1
+	}
+	c.V[x] = byte(result)
+	c.V[0xF] = cf
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 8XY5 VY is subtracted from VX.
+// VF is set to 0 when there's a borrow,
+// and 1 when there isn't.
+func (c *CPU) opSUB(opcode uint16) error {
+	x, y := xy(opcode)
+
+	var cf byte
+	if c.V[x] >= c.V[y] {
+		cf = 1
+	}
+	c.V[x] = c.V[x] - c.V[y]
+	c.V[0xF] = cf
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 8XY6	Shifts VX right by one.
+// VF is set to the value of the least significant
+// bit of VX before the shift.
+func (c *CPU) opSHR(opcode uint16) error {
+	x, y := xy(opcode)
+	if c.Quirks.ShiftUsesVY {
+		c.V[x] = c.V[y]
+	}
+	cf := c.V[x] & 0x01
+	c.V[x] = c.V[x] >> 1
+	c.V[0xF] = cf
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 8XY7	Sets VX to VY minus VX.
+// VF is set to 0 when there's a borrow,
+// and 1 when there isn't.
+func (c *CPU) opSUBN(opcode uint16) error {
+	x, y := xy(opcode)
+	var cf byte
+	if c.V[y] >= c.V[x] {
+		cf = 1
+	}
+	c.V[x] = c.V[y] - c.V[x]
+	c.V[0xF] = cf
+
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 8XYE	Shifts VX left by one.
+// VF is set to the value of the most significant
+// bit of VX before the shift.
+func (c *CPU) opSHL(opcode uint16) error {
+	x, y := xy(opcode)
+	if c.Quirks.ShiftUsesVY {
+		c.V[x] = c.V[y]
+	}
+	cf := c.V[x] >> 7
+	c.V[x] = c.V[x] << 1
+	c.V[0xF] = cf
+	c.ProgramCounter += 2
+	return nil
+}
+
+// 9XY0 Skip next instruction if Vx != Vy.
+//
+// The values of Vx and Vy are compared, and if they are
+// not equal, the program counter is increased by 2.
+func (c *CPU) opSNE(opcode uint16) error {
+	x, y := xy(opcode)
+	c.ProgramCounter += 2
+	if c.V[x] != c.V[y] {
+		c.ProgramCounter += 2
+	}
+	return nil
+}
+
+// ANNN: Sets I to the address NNN
+func (c *CPU) opLDI(opcode uint16) error {
+	c.I = opcode & 0x0FFF
+	c.ProgramCounter += 2
+	return nil
+}
+
+// BNNN	Jumps to the address NNN plus V0.
+func (c *CPU) opJPV0(opcode uint16) error {
+	reg := uint16(0)
+	if c.Quirks.JumpUsesVX {
+		// BXNN Jumps to the address XNN plus VX.
+		reg = (opcode & 0x0F00) >> 8
+	}
+	c.ProgramCounter = opcode&0x0FFF + uint16(c.V[reg])
+	return nil
+}
+
+// CXNN	Sets VX to the result of a bitwise and operation on a random number and NN.
+func (c *CPU) opRND(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	kk := byte(opcode)
+	var r int
+	if c.options.Rand != nil {
+		r = c.options.Rand.Intn(256)
+	} else {
+		r = rand.Intn(256)
+	}
+	c.V[x] = byte(r) & kk
+
+	c.ProgramCounter += 2
+	return nil
+}
+
+// DXYN	Draws a sprite at coordinate (VX, VY) that has a width of 8 pixels
+// and a height of N pixels. Each row of 8 pixels is read as bit-coded starting
+// from memory location I; I value doesn’t change after the execution of this instruction.
+// As described above, VF is set to 1 if any screen pixels are flipped from set to unset when
+// the sprite is drawn, and to 0 if that doesn’t happen
+func (c *CPU) opDRW(opcode uint16) error {
+	var cf byte
+	x := c.V[(opcode&0x0F00)>>8]
+	y := c.V[(opcode&0x00F0)>>4]
+	n := opcode & 0x000F
+	planes := c.Graphics.Planes()
+	if err := c.checkAddress(c.I, int(n)*spritePlanes(planes)); err != nil {
+		return err
+	}
+
+	clipX := c.Quirks.ClipX || c.Quirks.VIPSpriteWrap
+	clipY := c.Quirks.ClipY || c.Quirks.VIPSpriteWrap
+	if c.drawPlanes(planes, c.Memory[c.I:], n, x, y, clipX, clipY) {
+		cf = 0x01
+		c.collisions++
+	}
+
+	c.V[0xF] = cf
+	c.ProgramCounter += 2
+	c.draw()
+	return nil
+}
+
+// EX9E	Skips the next instruction if the key stored in VX is pressed.
+func (c *CPU) opSKP(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	down, err := c.keyPressed(c.V[x])
+	if err != nil {
+		return err
+	}
+	c.ProgramCounter += 2
+	if down {
+		c.ProgramCounter += 2
+	}
+	return nil
+}
+
+// EXA1	Skips the next instruction if the key stored in VX isn't pressed.
+func (c *CPU) opSKNP(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	down, err := c.keyPressed(c.V[x])
+	if err != nil {
+		return err
+	}
+	c.ProgramCounter += 2
+	if !down {
+		c.ProgramCounter += 2
+	}
+	return nil
+}
+
+// FX07	Sets VX to the value of the delay timer.
+func (c *CPU) opLDVxDT(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	c.V[x] = c.DelayTimer
+	c.ProgramCounter += 2
+	return nil
+}
+
+// FX0A	A key press is awaited, and then stored in VX.
+func (c *CPU) opLDVxK(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	if c.keysFed() {
+		if c.Quirks.WaitKeyOnRelease {
+			return c.waitKeyRelease(x)
+		}
+		return c.waitKeyPress(x)
+	}
+	b, ok, err := c.getKey()
+	if !ok {
+		return err
+	}
+
+	c.V[x] = b
+	c.ProgramCounter += 2
+	return nil
+}
+
+// waitKeyPress is FX0A when the key state is fed. It leaves the program
+// counter alone, so FX0A runs again, until a key goes down. Keys that were
+// already held down when it started waiting don't count.
+func (c *CPU) waitKeyPress(x uint16) error {
+	for k := byte(0); k < 16; k++ {
+		if c.presses&(1<<k) != 0 {
+			c.V[x] = k
+			c.ProgramCounter += 2
+			return nil
+		}
+	}
+	return nil
+}
+
+// waitKeyRelease is FX0A under Quirks.WaitKeyOnRelease. It leaves the
+// program counter alone, so FX0A runs again, until a key that was pressed
+// is released.
+func (c *CPU) waitKeyRelease(x uint16) error {
+	if !c.waiting {
+		for k := byte(0); k < 16; k++ {
+			if c.keyDown(k) {
+				c.waiting, c.waitKey = true, k
+				break
+			}
+		}
+		return nil
+	}
+	if c.keyDown(c.waitKey) {
+		return nil
+	}
+
+	c.waiting = false
+	c.V[x] = c.waitKey
+	c.ProgramCounter += 2
+	return nil
+}
+
+// FX15	Sets the delay timer to VX.
+func (c *CPU) opLDDTVx(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	c.DelayTimer = c.V[x]
+	c.ProgramCounter += 2
+	return nil
+}
+
+// FX18 Sets the sound timer to the value of Vx
+func (c *CPU) opLDSTVx(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	c.SoundTimer = c.V[x]
+	c.updateBuzzer()
+	c.ProgramCounter += 2
+	return nil
+}
+
+// FX1E	Adds VX to I.
+func (c *CPU) opADDI(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	c.I = c.I + uint16(c.V[x])
+	c.ProgramCounter += 2
+	return nil
+}
+
+// FX29	 Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
+func (c *CPU) opLDF(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	c.I = FontAddress + uint16(c.V[x]&0x0F)*0x05
+	c.ProgramCounter += 2
+	return nil
+}
+
+// FX33	Stores the binary-coded decimal representation of VX,
+// with the most significant of three digits at the address in I,
+// the middle digit at I plus 1,
+// and the least significant digit at I plus 2. (In other words,
+// take the decimal representation of VX, place the hundreds digit in memory at location in I,
+// the tens digit at location I+1, and the ones digit at location I+2.)
+func (c *CPU) opLDB(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	if err := c.checkAddress(c.I, 3); err != nil {
+		return err
+	}
+	c.writeMemory(c.I, c.V[x]/100)
+	c.writeMemory(c.I+1, (c.V[x]/10)%10)
+	c.writeMemory(c.I+2, (c.V[x]%100)%10)
+	c.ProgramCounter += 2
+	return nil
+}
+
+// FX55	Stores V0 to VX (including VX) in memory starting at address I.
+func (c *CPU) opLDIVx(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	if err := c.checkAddress(c.I, int(x)+1); err != nil {
+		return err
+	}
+	for i := 0; uint16(i) <= x; i++ {
+		c.writeMemory(c.I+uint16(i), c.V[i])
+	}
+	if c.Quirks.LoadStoreIncrementsI {
+		c.I += x + 1
+	}
+	c.ProgramCounter += 2
+	return nil
+}
+
+// FX65 Fills V0 to VX (including VX) with values from memory starting at address I.
+func (c *CPU) opLDVxI(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	if err := c.checkAddress(c.I, int(x)+1); err != nil {
+		return err
+	}
+	for i := 0; byte(i) <= byte(x); i++ {
+		c.V[uint16(i)] = c.Memory[c.I+uint16(i)]
+	}
+	if c.Quirks.LoadStoreIncrementsI {
+		c.I += x + 1
+	}
+	c.ProgramCounter += 2
+	return nil
+}
+
+// xy returns the X and Y register numbers of an XY opcode.
+func xy(opcode uint16) (x, y uint16) {
+	return (opcode & 0x0F00) >> 8, (opcode & 0x00F0) >> 4
+}
@@ -0,0 +1,354 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPU_RegisterOpcode(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0x01, 0x23, // custom: V1 = 0x23
+		0x60, 0x05, // LD V0, 0x05 (replaced below)
+	})
+
+	cpu.RegisterOpcode(0xFF00, 0x0100, func(c *CPU, opcode uint16) error {
+		c.V[1] = byte(opcode)
+		c.ProgramCounter += 2
+		return nil
+	})
+	cpu.RegisterOpcode(0xF000, 0x6000, func(c *CPU, opcode uint16) error {
+		c.V[0] = 0xEE
+		c.ProgramCounter += 2
+		return nil
+	})
+
+	if err := cpu.RunN(2); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, byte(0x23), cpu.V[1])
+	assert.Equal(t, byte(0xEE), cpu.V[0])
+	assert.Equal(t, uint16(0x204), cpu.ProgramCounter)
+
+	// Other CPUs are unaffected.
+	other := NewCPU(nil)
+	other.LoadBytes([]byte{0x01, 0x23})
+	assert.Equal(t, &ExecutionError{PC: 0x200, Opcode: 0x0123, Err: &UnknownOpcode{Opcode: 0x0123}}, other.RunN(1))
+}
+
+func TestCPU_ExecuteOpcode(t *testing.T) {
+	cpu := NewCPU(nil)
+	assert.NoError(t, cpu.ExecuteOpcode(0x6A42)) // LD VA, 0x42
+	assert.Equal(t, byte(0x42), cpu.V[0xA])
+	assert.Equal(t, uint16(0x202), cpu.ProgramCounter)
+
+	assert.Equal(t, &UnknownOpcode{Opcode: 0x0123}, cpu.ExecuteOpcode(0x0123))
+}
+
+func TestCPU_StackErrors(t *testing.T) {
+	cpu := NewCPU(nil)
+	assert.Equal(t, &StackError{}, cpu.ExecuteOpcode(0x00EE)) // RET
+
+	// All 16 levels can be used.
+	for i := 0; i < len(cpu.Stack); i++ {
+		assert.NoError(t, cpu.ExecuteOpcode(0x2200)) // CALL 0x200
+	}
+	assert.Equal(t, &StackError{Overflow: true}, cpu.ExecuteOpcode(0x2200))
+}
+
+func TestCPU_OnStackError(t *testing.T) {
+	cpu := NewCPU(nil)
+	var errs []*StackError
+	cpu.OnStackError = func(err *StackError) {
+		errs = append(errs, err)
+	}
+	cpu.LoadBytes([]byte{
+		0x00, 0xEE, // RET
+		0x60, 0x01, // LD V0, 1
+	})
+
+	// The underflow is reported and execution carries on.
+	assert.NoError(t, cpu.RunN(2))
+	assert.Equal(t, []*StackError{{}}, errs)
+	assert.Equal(t, byte(1), cpu.V[0])
+	assert.Equal(t, uint16(0x204), cpu.ProgramCounter)
+	assert.Equal(t, byte(0), cpu.StackPointer)
+
+	// An overflow replaces the top of the stack.
+	errs = nil
+	for i := 0; i < len(cpu.Stack); i++ {
+		assert.NoError(t, cpu.ExecuteOpcode(0x2300)) // CALL 0x300
+	}
+	assert.Empty(t, errs)
+	cpu.ProgramCounter = 0x310
+	assert.NoError(t, cpu.ExecuteOpcode(0x2400)) // CALL 0x400
+	assert.Equal(t, []*StackError{{Overflow: true}}, errs)
+	assert.Equal(t, byte(len(cpu.Stack)), cpu.StackPointer)
+	assert.Equal(t, uint16(0x310), cpu.Stack[cpu.StackPointer-1])
+	assert.Equal(t, uint16(0x400), cpu.ProgramCounter)
+}
+
+func TestCPU_DrawOutOfMemory(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.Graphics.Display = NullDisplay
+	cpu.I = uint16(len(cpu.Memory) - 2)
+	assert.Equal(t, &AddressError{Address: len(cpu.Memory) + 2}, cpu.ExecuteOpcode(0xD005))
+}
+
+func TestCPU_DrawAtEndOfMemory(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.Graphics.Display = NullDisplay
+	cpu.LoadBytes([]byte{
+		0xAF, 0xFF, // LD I, 0xFFF
+		0xD0, 0x0F, // DRW V0, V0, 15
+	})
+
+	// A tall sprite running past the end of memory is an error, not a
+	// panic, and the screen is left alone.
+	assert.NotPanics(t, func() {
+		assert.Equal(t, &ExecutionError{
+			PC:     0x202,
+			Cycle:  1,
+			Opcode: 0xD00F,
+			Err:    &AddressError{Address: 0xFFF + 14},
+		}, cpu.RunN(2))
+	})
+	assert.Equal(t, 0, cpu.Graphics.CountOnPixels())
+	assert.Equal(t, uint16(0x202), cpu.ProgramCounter)
+
+	// A sprite ending on the last byte is drawn.
+	cpu.Memory[0xFFF] = 0xFF
+	assert.NoError(t, cpu.ExecuteOpcode(0xD001))
+	assert.Equal(t, 8, cpu.Graphics.CountOnPixels())
+}
+
+func TestCPU_ProgramCounterOutOfMemory(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.ProgramCounter = uint16(len(cpu.Memory) - 1)
+	assert.Equal(t, &ExecutionError{PC: cpu.ProgramCounter, Err: &AddressError{Address: len(cpu.Memory)}}, cpu.RunN(1))
+}
+
+func FuzzExecuteOpcode(f *testing.F) {
+	for _, op := range SupportedOpcodes() {
+		f.Add(op.Pattern, uint16(0x200), byte(0), byte(0xFF), byte(0x10))
+	}
+	f.Add(uint16(0x00EE), uint16(0xFFFF), byte(15), byte(0xFF), byte(0xFF))
+	f.Add(uint16(0xDFFF), uint16(0x0FFF), byte(0), byte(0xFF), byte(0xFF))
+
+	f.Fuzz(func(t *testing.T, opcode, i uint16, sp, vx, vy byte) {
+		cpu := NewCPU(nil)
+		cpu.Graphics.Display = NullDisplay
+		cpu.Keypad = NullKeypad
+		cpu.Buzzer = NullBuzzer
+		cpu.I = i
+		cpu.StackPointer = sp % byte(len(cpu.Stack)+1)
+		x, y := xy(opcode)
+		cpu.V[x] = vx
+		cpu.V[y] = vy
+
+		// Errors are fine, panics are not.
+		cpu.ExecuteOpcode(opcode)
+	})
+}
+
+func TestCPU_8XYn_flags(t *testing.T) {
+	tests := []struct {
+		name       string
+		opcode     uint16
+		vx, vy     byte
+		result, vf byte
+	}{
+		{"ADD 0+0", 0x8124, 0x00, 0x00, 0x00, 0},
+		{"ADD no carry", 0x8124, 0x01, 0xFE, 0xFF, 0},
+		{"ADD carry", 0x8124, 0xFF, 0x01, 0x00, 1},
+		{"ADD FF+FF", 0x8124, 0xFF, 0xFF, 0xFE, 1},
+		{"SUB 0-0", 0x8125, 0x00, 0x00, 0x00, 1},
+		{"SUB equal", 0x8125, 0x42, 0x42, 0x00, 1},
+		{"SUB no borrow", 0x8125, 0xFF, 0x01, 0xFE, 1},
+		{"SUB borrow", 0x8125, 0x00, 0x01, 0xFF, 0},
+		{"SUB 0-FF", 0x8125, 0x00, 0xFF, 0x01, 0},
+		{"SHR 0", 0x8126, 0x00, 0x00, 0x00, 0},
+		{"SHR odd", 0x8126, 0xFF, 0x00, 0x7F, 1},
+		{"SHR even", 0x8126, 0xFE, 0x00, 0x7F, 0},
+		{"SUBN 0-0", 0x8127, 0x00, 0x00, 0x00, 1},
+		{"SUBN equal", 0x8127, 0x42, 0x42, 0x00, 1},
+		{"SUBN no borrow", 0x8127, 0x01, 0xFF, 0xFE, 1},
+		{"SUBN borrow", 0x8127, 0x01, 0x00, 0xFF, 0},
+		{"SUBN FF-0", 0x8127, 0xFF, 0x00, 0x01, 0},
+		{"SHL 0", 0x812E, 0x00, 0x00, 0x00, 0},
+		{"SHL high bit", 0x812E, 0xFF, 0x00, 0xFE, 1},
+		{"SHL no high bit", 0x812E, 0x7F, 0x00, 0xFE, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := NewCPU(nil)
+			cpu.V[1] = tt.vx
+			cpu.V[2] = tt.vy
+			cpu.V[0xF] = 0xAA
+
+			assert.NoError(t, cpu.ExecuteOpcode(tt.opcode))
+			assert.Equal(t, tt.result, cpu.V[1], "result")
+			assert.Equal(t, tt.vf, cpu.V[0xF], "VF")
+			assert.Equal(t, tt.vy, cpu.V[2], "VY")
+		})
+	}
+}
+
+func TestCPU_8XYn_flagWinsOverResult(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.V[0xF] = 0xFF
+	cpu.V[1] = 0x01
+	assert.NoError(t, cpu.ExecuteOpcode(0x8F14)) // ADD VF, V1
+	assert.Equal(t, byte(1), cpu.V[0xF])
+
+	cpu.V[0xF] = 0x00
+	assert.NoError(t, cpu.ExecuteOpcode(0x8F15)) // SUB VF, V1
+	assert.Equal(t, byte(0), cpu.V[0xF])
+}
+
+func TestCPU_8XYn_logicLeavesVF(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode uint16
+		result byte
+	}{
+		{"OR", 0x8121, 0x0E},
+		{"AND", 0x8122, 0x08},
+		{"XOR", 0x8123, 0x06},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := NewCPU(nil)
+			assert.False(t, cpu.Quirks.VFResetOnLogic)
+			cpu.V[1] = 0x0C
+			cpu.V[2] = 0x0A
+			cpu.V[0xF] = 0xAA
+
+			assert.NoError(t, cpu.ExecuteOpcode(tt.opcode))
+			assert.Equal(t, tt.result, cpu.V[1], "result")
+			assert.Equal(t, byte(0xAA), cpu.V[0xF], "VF")
+		})
+	}
+}
+
+func TestCPU_CLS_draws(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.Graphics.Set(1, 1, true)
+	var rendered []bool
+	cpu.Graphics.Display = DisplayFunc(func(g *Graphics) error {
+		rendered = append(rendered, g.GetPixel(1, 1))
+		return nil
+	})
+
+	assert.NoError(t, cpu.ExecuteOpcode(0x00E0)) // CLS
+	assert.Equal(t, []bool{false}, rendered)
+}
+
+func TestCPU_8XYn_unknown(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{0x81, 0x0A})
+
+	assert.Equal(t, &ExecutionError{PC: 0x200, Opcode: 0x810A, Err: &UnknownOpcode{Opcode: 0x810A}}, cpu.RunN(1))
+	assert.Equal(t, uint16(0x200), cpu.ProgramCounter)
+}
+
+func TestCPU_DRW_wrapCollision(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.Graphics.Display = NullDisplay
+	cpu.Graphics.Set(2, 0, true)
+	cpu.LoadBytes([]byte{
+		0xA3, 0x00, // LD I, 0x300
+		0x60, 0x3D, // LD V0, 61
+		0x61, 0x1F, // LD V1, 31
+		0xD0, 0x12, // DRW V0, V1, 2
+	})
+	copy(cpu.Memory[0x300:], []byte{0x00, 0x3F})
+
+	assert.NoError(t, cpu.RunN(4))
+	assert.Equal(t, byte(1), cpu.V[0xF])
+	assert.False(t, cpu.Graphics.GetPixel(2, 0))
+	assert.True(t, cpu.Graphics.GetPixel(0, 0))
+	assert.True(t, cpu.Graphics.GetPixel(63, 0))
+}
+
+func TestSupportedOpcodes(t *testing.T) {
+	specs := make(map[uint16]OpcodeSpec)
+	for _, op := range SupportedOpcodes() {
+		specs[op.Pattern] = op
+		assert.NotEmpty(t, op.Mnemonic, "0x%04X", op.Pattern)
+		assert.NotEmpty(t, op.Syntax, "0x%04X", op.Pattern)
+		assert.NotEmpty(t, op.Description, "0x%04X", op.Pattern)
+	}
+
+	assert.Equal(t, OpcodeSpec{
+		Mask:        0xF000,
+		Pattern:     0xD000,
+		Mnemonic:    "DRW",
+		Syntax:      "DRW V{x}, V{y}, {n}",
+		Description: "Draw the N byte sprite at I at (VX, VY). VF is set on a collision.",
+	}, specs[0xD000])
+	assert.Equal(t, "RND", specs[0xC000].Mnemonic)
+	for _, n := range []uint16{0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0xE} {
+		assert.Contains(t, specs, 0x8000|n)
+		assert.Equal(t, uint16(0xF00F), specs[0x8000|n].Mask)
+	}
+}
+
+// vsyncDisplay records the calls made to it.
+type vsyncDisplay struct {
+	calls []string
+}
+
+func (d *vsyncDisplay) Render(*Graphics) error {
+	d.calls = append(d.calls, "render")
+	return nil
+}
+
+func (d *vsyncDisplay) WaitForVSync() {
+	d.calls = append(d.calls, "vsync")
+}
+
+func TestCPU_DRW_waitsForVSync(t *testing.T) {
+	d := &vsyncDisplay{}
+	cpu := NewCPU(nil)
+	cpu.Graphics.Display = d
+	cpu.LoadBytes([]byte{
+		0xD0, 0x05, // DRW V0, V0, 5
+	})
+
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, []string{"vsync", "render"}, d.calls)
+}
+
+func TestCPU_shift_VFAsOperand(t *testing.T) {
+	tests := []struct {
+		name        string
+		opcode      uint16
+		shiftUsesVY bool
+		vf, v1      byte
+		want        byte
+	}{
+		{"8FF6", 0x8FF6, false, 0x03, 0x00, 1},
+		{"8FF6 even", 0x8FF6, false, 0x02, 0x00, 0},
+		{"8FF6 VY quirk", 0x8FF6, true, 0x03, 0x00, 1},
+		{"8FFE", 0x8FFE, false, 0x81, 0x00, 1},
+		{"8FFE no high bit", 0x8FFE, false, 0x40, 0x00, 0},
+		{"8FFE VY quirk", 0x8FFE, true, 0x81, 0x00, 1},
+		{"8F16", 0x8F16, false, 0x02, 0x03, 0},
+		{"8F16 VY quirk", 0x8F16, true, 0x02, 0x03, 1},
+		{"8F1E", 0x8F1E, false, 0x01, 0x80, 0},
+		{"8F1E VY quirk", 0x8F1E, true, 0x01, 0x80, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := NewCPU(&Options{Quirks: Quirks{ShiftUsesVY: tt.shiftUsesVY}})
+			cpu.V[0xF] = tt.vf
+			cpu.V[1] = tt.v1
+
+			assert.NoError(t, cpu.ExecuteOpcode(tt.opcode))
+			// VF holds the bit shifted out, not the shifted value.
+			assert.Equal(t, tt.want, cpu.V[0xF])
+		})
+	}
+}
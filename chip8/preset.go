@@ -0,0 +1,138 @@
+package chip8
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Preset selects a bundle of settings that matches a CHIP-8 platform.
+type Preset int
+
+const (
+	// PresetNone applies no preset.
+	PresetNone Preset = iota
+
+	// PresetVIP matches the CHIP-8 interpreter on the COSMAC VIP.
+	PresetVIP
+
+	// PresetSCHIP matches SUPER-CHIP 1.1 on the HP 48.
+	PresetSCHIP
+
+	// PresetXOCHIP matches XO-CHIP as implemented by Octo.
+	PresetXOCHIP
+)
+
+// PresetConfig is the configuration a Preset stands for.
+type PresetConfig struct {
+	// InstructionsPerFrame is the number of instructions executed per
+	// frame. The clock speed is InstructionsPerFrame * FrameRate.
+	InstructionsPerFrame int
+
+	// Quirks are the platform's quirks.
+	Quirks Quirks
+
+	// Width and Height are the platform's initial resolution.
+	Width, Height int
+}
+
+// ClockSpeed returns the number of instructions executed per second.
+func (p PresetConfig) ClockSpeed() time.Duration {
+	return time.Duration(p.InstructionsPerFrame) * FrameRate
+}
+
+var presets = map[Preset]PresetConfig{
+	PresetVIP: {
+		InstructionsPerFrame: 15,
+		Quirks: Quirks{
+			ShiftUsesVY:          true,
+			LoadStoreIncrementsI: true,
+			VFResetOnLogic:       true,
+			VIPSpriteWrap:        true,
+		},
+		Width:  GraphicsWidth,
+		Height: GraphicsHeight,
+	},
+	PresetSCHIP: {
+		InstructionsPerFrame: 30,
+		Quirks: Quirks{
+			JumpUsesVX: true,
+		},
+		Width:  GraphicsWidth,
+		Height: GraphicsHeight,
+	},
+	PresetXOCHIP: {
+		InstructionsPerFrame: 1000,
+		Quirks: Quirks{
+			ShiftUsesVY:          true,
+			LoadStoreIncrementsI: true,
+		},
+		Width:  GraphicsWidth,
+		Height: GraphicsHeight,
+	},
+}
+
+// presetNames are the names ParsePreset accepts, in order of Preset.
+var presetNames = []string{"chip8", "vip", "schip", "xochip"}
+
+// ParsePreset returns the Preset with the given name, one of PresetNames:
+// chip8 for PresetNone, vip, schip or xochip. Case is ignored.
+func ParsePreset(name string) (Preset, error) {
+	for i, n := range presetNames {
+		if strings.EqualFold(name, n) {
+			return Preset(i), nil
+		}
+	}
+	return PresetNone, fmt.Errorf("chip8: unknown platform %q, want one of %s", name, strings.Join(presetNames, ", "))
+}
+
+// PresetNames returns the names ParsePreset accepts.
+func PresetNames() []string {
+	return append([]string(nil), presetNames...)
+}
+
+// Config returns the configuration of the preset, and false for PresetNone
+// and unknown presets.
+func (p Preset) Config() (PresetConfig, bool) {
+	c, ok := presets[p]
+	return c, ok
+}
+
+// applyPreset fills in the settings of opts.Preset that opts doesn't set
+// explicitly.
+func applyPreset(opts *Options) {
+	p, ok := opts.Preset.Config()
+	if !ok {
+		return
+	}
+	if opts.ClockSpeed <= 0 {
+		opts.ClockSpeed = p.ClockSpeed()
+	}
+	if opts.Quirks == (Quirks{}) {
+		opts.Quirks = p.Quirks
+	}
+}
+
+// DetectPlatform guesses the platform a ROM was written for from the
+// opcodes in it, so a front-end can pick a preset without being told. It
+// returns PresetSCHIP if the ROM uses a SUPER-CHIP opcode that the preset
+// runs: 00FE, 00FF or FX30. Otherwise, including for an empty ROM, it
+// returns PresetNone for plain CHIP-8.
+//
+// It is a heuristic: only the words at even offsets are looked at, as
+// instructions normally are, and data that happens to look like one of
+// these opcodes gives a false positive.
+func DetectPlatform(b []byte) Preset {
+	for i := 0; i+1 < len(b); i += 2 {
+		if isSCHIPOpcode(uint16(b[i])<<8 | uint16(b[i+1])) {
+			return PresetSCHIP
+		}
+	}
+	return PresetNone
+}
+
+// isSCHIPOpcode reports whether opcode is one of the SUPER-CHIP opcodes
+// PresetSCHIP runs.
+func isSCHIPOpcode(opcode uint16) bool {
+	return opcode == 0x00FE || opcode == 0x00FF || opcode&0xF0FF == 0xF030
+}
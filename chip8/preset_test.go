@@ -0,0 +1,89 @@
+package chip8
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreset_Config(t *testing.T) {
+	tests := []struct {
+		preset     Preset
+		clockSpeed time.Duration
+		quirks     Quirks
+	}{
+		{PresetVIP, 900, Quirks{ShiftUsesVY: true, LoadStoreIncrementsI: true, VFResetOnLogic: true, VIPSpriteWrap: true}},
+		{PresetSCHIP, 1800, Quirks{JumpUsesVX: true}},
+		{PresetXOCHIP, 60000, Quirks{ShiftUsesVY: true, LoadStoreIncrementsI: true}},
+	}
+	for _, tt := range tests {
+		p, ok := tt.preset.Config()
+		assert.True(t, ok)
+		assert.Equal(t, tt.clockSpeed, p.ClockSpeed())
+		assert.Equal(t, tt.quirks, p.Quirks)
+		assert.Equal(t, GraphicsWidth, p.Width)
+		assert.Equal(t, GraphicsHeight, p.Height)
+
+		cpu := NewCPU(&Options{Preset: tt.preset})
+		assert.Equal(t, tt.clockSpeed, cpu.options.ClockSpeed)
+		assert.Equal(t, tt.quirks, cpu.Quirks)
+		assert.Equal(t, p.Width, cpu.Graphics.Width())
+		assert.Equal(t, p.Height, cpu.Graphics.Height())
+	}
+
+	_, ok := PresetNone.Config()
+	assert.False(t, ok)
+}
+
+func TestNewCPU_presetOverrides(t *testing.T) {
+	cpu := NewCPU(&Options{
+		Preset:     PresetVIP,
+		ClockSpeed: 500,
+		Quirks:     Quirks{JumpUsesVX: true},
+	})
+	assert.Equal(t, time.Duration(500), cpu.options.ClockSpeed)
+	assert.Equal(t, Quirks{JumpUsesVX: true}, cpu.Quirks)
+}
+
+func TestDetectPlatform(t *testing.T) {
+	cases := []struct {
+		name string
+		rom  []byte
+		want Preset
+	}{
+		{"empty", nil, PresetNone},
+		{"chip8", []byte{0x00, 0xE0, 0xA2, 0x0A, 0xD0, 0x15, 0x12, 0x00}, PresetNone},
+		{"HIGH", []byte{0x00, 0xE0, 0x00, 0xFF}, PresetSCHIP},
+		{"LOW", []byte{0x00, 0xFE}, PresetSCHIP},
+		{"FX30", []byte{0xF3, 0x30, 0xD0, 0x1A}, PresetSCHIP},
+		// Opcodes the preset doesn't run don't count.
+		{"SCD", []byte{0x00, 0xC4, 0x12, 0x00}, PresetNone},
+		{"DXY0", []byte{0xA2, 0x0A, 0xD1, 0x20}, PresetNone},
+		{"FX75", []byte{0xF7, 0x75}, PresetNone},
+		// Only whole instructions count.
+		{"odd offset", []byte{0x12, 0x00, 0xFF, 0x00}, PresetNone},
+		{"trailing byte", []byte{0x12, 0x00, 0xD0}, PresetNone},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, DetectPlatform(c.rom))
+		})
+	}
+}
+
+func TestParsePreset(t *testing.T) {
+	for name, want := range map[string]Preset{
+		"chip8":  PresetNone,
+		"vip":    PresetVIP,
+		"SCHIP":  PresetSCHIP,
+		"xochip": PresetXOCHIP,
+	} {
+		p, err := ParsePreset(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, want, p, name)
+	}
+
+	_, err := ParsePreset("megachip")
+	assert.Error(t, err)
+}
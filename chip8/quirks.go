@@ -0,0 +1,176 @@
+package chip8
+
+import (
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Quirks toggles behaviours that differ between CHIP-8 interpreters. The
+// zero value matches the behaviour most modern ROMs expect.
+type Quirks struct {
+	// ShiftUsesVY makes 8XY6 and 8XYE shift VY into VX, as the COSMAC VIP
+	// did, instead of shifting VX in place.
+	ShiftUsesVY bool `json:"shiftUsesVY"`
+
+	// LoadStoreIncrementsI makes FX55 and FX65 leave I pointing one past
+	// the last register transferred.
+	LoadStoreIncrementsI bool `json:"loadStoreIncrementsI"`
+
+	// JumpUsesVX makes BNNN jump to NNN plus VX, where X is the high
+	// nibble of NNN (the SCHIP BXNN behaviour).
+	JumpUsesVX bool `json:"jumpUsesVX"`
+
+	// VFResetOnLogic makes 8XY1, 8XY2 and 8XY3 reset VF to 0, as a side
+	// effect the COSMAC VIP had.
+	VFResetOnLogic bool `json:"vfResetOnLogic"`
+
+	// ClipX and ClipY make DXYN clip sprites at the right and bottom edges
+	// of the screen instead of wrapping them around to the other side.
+	// The position a sprite is drawn at wraps either way.
+	ClipX bool `json:"clipX"`
+	ClipY bool `json:"clipY"`
+
+	// VIPSpriteWrap draws sprites as the COSMAC VIP did: the position
+	// wraps around the screen, but the sprite itself is clipped at both
+	// the right and bottom edges. It implies ClipX and ClipY.
+	VIPSpriteWrap bool `json:"vipSpriteWrap"`
+
+	// WaitKeyOnRelease makes FX0A wait for a key to be pressed and then
+	// released, as the COSMAC VIP did, instead of completing on the press.
+	// It follows the held keys, as fed by a KeyPoller Keypad or with
+	// PressKey and ReleaseKey, and repeats FX0A each cycle until the key is
+	// released. Keypads that can't tell when a key is released are asked
+	// for a key as usual.
+	WaitKeyOnRelease bool `json:"waitKeyOnRelease"`
+}
+
+//go:embed quirkdb.json
+var quirkDBJSON []byte
+
+// DefaultQuirkDB is the QuirkDB consulted by CPU.ApplyProfile when the CPU
+// has no QuirkDB of its own. It is populated from the embedded database.
+var DefaultQuirkDB = mustLoadQuirkDB(quirkDBJSON)
+
+// ROMHash returns the hex encoded SHA-1 of a ROM image. This is the key used
+// to look up profiles in a QuirkDB.
+func ROMHash(b []byte) string {
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// QuirkDB maps ROM hashes to the Quirks they are known to need.
+type QuirkDB struct {
+	mu       sync.RWMutex
+	profiles map[string]Quirks
+}
+
+// NewQuirkDB returns an empty QuirkDB.
+func NewQuirkDB() *QuirkDB {
+	return &QuirkDB{profiles: make(map[string]Quirks)}
+}
+
+// Register records the quirks for the ROM with the given hash, replacing
+// any existing entry.
+func (db *QuirkDB) Register(hash string, q Quirks) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.profiles[hash] = q
+}
+
+// Lookup returns the quirks registered for hash.
+func (db *QuirkDB) Lookup(hash string) (Quirks, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	q, ok := db.profiles[hash]
+	return q, ok
+}
+
+// quirkDBEntry is the on-disk form of a single QuirkDB record.
+type quirkDBEntry struct {
+	Title  string `json:"title"`
+	Quirks Quirks `json:"quirks"`
+}
+
+func mustLoadQuirkDB(b []byte) *QuirkDB {
+	var entries map[string]quirkDBEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		panic(fmt.Sprintf("chip8: invalid embedded quirk database: %s", err.Error()))
+	}
+
+	db := NewQuirkDB()
+	for hash, e := range entries {
+		db.Register(hash, e.Quirks)
+	}
+	return db
+}
+
+// ApplyProfile sets the CPU's quirks to the profile registered for the ROM
+// hash, if any. It reports whether a profile was found.
+func (c *CPU) ApplyProfile(hash string) bool {
+	q, ok := c.quirkDB().Lookup(hash)
+	if ok {
+		c.Quirks = q
+	}
+	return ok
+}
+
+// DetectQuirks scans the program in memory for opcode patterns that hint at
+// the quirks it was written for, and returns the Quirks it suggests. It is a
+// best-effort guess for ROMs without a profile; it doesn't change c.Quirks.
+//
+// The heuristics are:
+//   - ShiftUsesVY if a shift names a source register other than VX or V0,
+//     which only makes sense if VY is shifted.
+//   - LoadStoreIncrementsI if FX55 or FX65 is directly followed by another
+//     FX55 or FX65, which relies on I having moved on.
+//   - JumpUsesVX if a BNNN names a register that the program loads but V0
+//     is never loaded, so the jump only makes sense as BXNN.
+//
+// VFResetOnLogic can't be detected and is never suggested.
+func (c *CPU) DetectQuirks() Quirks {
+	var (
+		q             Quirks
+		loaded        [16]bool
+		jumps         []uint16
+		prevLoadStore bool
+	)
+	program := c.Memory[0x200:]
+	for i := 0; i+1 < len(program); i += 2 {
+		opcode := uint16(program[i])<<8 | uint16(program[i+1])
+		x, y := xy(opcode)
+
+		loadStore := opcode&0xF0FF == 0xF055 || opcode&0xF0FF == 0xF065
+		if loadStore && prevLoadStore {
+			q.LoadStoreIncrementsI = true
+		}
+		prevLoadStore = loadStore
+
+		switch {
+		case opcode&0xF00F == 0x8006, opcode&0xF00F == 0x800E:
+			if y != x && y != 0 {
+				q.ShiftUsesVY = true
+			}
+		case opcode&0xF000 == 0x6000:
+			loaded[x] = true
+		case opcode&0xF000 == 0xB000:
+			jumps = append(jumps, x)
+		}
+	}
+	for _, x := range jumps {
+		if x != 0 && loaded[x] && !loaded[0] {
+			q.JumpUsesVX = true
+		}
+	}
+	return q
+}
+
+func (c *CPU) quirkDB() *QuirkDB {
+	if c.QuirkDB == nil {
+		return DefaultQuirkDB
+	}
+	return c.QuirkDB
+}
@@ -0,0 +1,228 @@
+package chip8
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestROMHash(t *testing.T) {
+	assert.Equal(t, "da39a3ee5e6b4b0d3255bfef95601890afd80709", ROMHash(nil))
+}
+
+func TestCPU_ApplyProfile(t *testing.T) {
+	program := []byte{0x81, 0x26} // SHR V1, V2
+	hash := ROMHash(program)
+
+	db := NewQuirkDB()
+	db.Register(hash, Quirks{ShiftUsesVY: true})
+
+	cpu := NewCPU(DefaultOptions)
+	cpu.QuirkDB = db
+	assert.False(t, cpu.ApplyProfile(ROMHash([]byte{0x00})))
+	assert.Equal(t, Quirks{}, cpu.Quirks)
+
+	assert.True(t, cpu.ApplyProfile(hash))
+	assert.Equal(t, Quirks{ShiftUsesVY: true}, cpu.Quirks)
+
+	cpu.LoadBytes(program)
+	cpu.V[1] = 0x01
+	cpu.V[2] = 0x06
+	_, err := cpu.emulateCycle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, byte(0x03), cpu.V[1])
+	assert.Equal(t, byte(0x00), cpu.V[0xF])
+}
+
+func TestDefaultQuirkDB(t *testing.T) {
+	rom, err := DemoROM("bounce")
+	assert.NoError(t, err)
+	q, ok := DefaultQuirkDB.Lookup(ROMHash(rom))
+	assert.True(t, ok)
+	assert.Equal(t, Quirks{}, q)
+
+	cpu := NewCPU(nil)
+	cpu.Quirks.ShiftUsesVY = true
+	assert.True(t, cpu.ApplyProfile(ROMHash(rom)))
+	assert.Equal(t, Quirks{}, cpu.Quirks)
+
+	rom, err = os.ReadFile(filepath.Join("testdata", "vipquirks.ch8"))
+	assert.NoError(t, err)
+	q, ok = DefaultQuirkDB.Lookup(ROMHash(rom))
+	assert.True(t, ok)
+	assert.Equal(t, Quirks{ShiftUsesVY: true, LoadStoreIncrementsI: true}, q)
+
+	// At least one shipped profile changes the quirks.
+	nonZero := false
+	for _, q := range DefaultQuirkDB.profiles {
+		nonZero = nonZero || q != Quirks{}
+	}
+	assert.True(t, nonZero)
+}
+
+func TestCPU_VFResetOnLogic(t *testing.T) {
+	for _, op := range []byte{0x01, 0x02, 0x03} {
+		for _, reset := range []bool{false, true} {
+			cpu := NewCPU(DefaultOptions)
+			cpu.Quirks.VFResetOnLogic = reset
+			cpu.LoadBytes([]byte{
+				0x6F, 0x01, // LD VF, 0x01
+				0x60, 0x0C, // LD V0, 0x0C
+				0x61, 0x0A, // LD V1, 0x0A
+				0x80, 0x10 | op, // OR/AND/XOR V0, V1
+			})
+			for i := 0; i < 4; i++ {
+				if _, err := cpu.emulateCycle(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want := byte(0x01)
+			if reset {
+				want = 0x00
+			}
+			assert.Equal(t, want, cpu.V[0xF], "op=8XY%X reset=%v", op, reset)
+		}
+	}
+}
+
+func TestCPU_DetectQuirks(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0x60, 0x00, // LD V0, 0x00
+		0x81, 0x06, // SHR V1, V0
+		0xF3, 0x55, // LD [I], V3
+		0xA3, 0x00, // LD I, 0x300
+		0xF3, 0x65, // LD V3, [I]
+		0xB2, 0x00, // JP V0, 0x200
+	})
+	assert.Equal(t, Quirks{}, cpu.DetectQuirks())
+
+	cpu = NewCPU(nil)
+	cpu.LoadBytes([]byte{
+		0x62, 0x04, // LD V2, 0x04
+		0x81, 0x26, // SHR V1, V2
+		0xF3, 0x55, // LD [I], V3
+		0xF3, 0x55, // LD [I], V3
+		0xB2, 0x00, // JP V2, 0x200
+	})
+	assert.Equal(t, Quirks{
+		ShiftUsesVY:          true,
+		LoadStoreIncrementsI: true,
+		JumpUsesVX:           true,
+	}, cpu.DetectQuirks())
+	// The CPU's own quirks are left alone.
+	assert.Equal(t, Quirks{}, cpu.Quirks)
+}
+
+func TestCPU_VIPSpriteWrap(t *testing.T) {
+	program := []byte{
+		0xA3, 0x00, // LD I, 0x300
+		0x60, 0x7E, // LD V0, 126 (wraps to 62)
+		0x61, 0x1F, // LD V1, 31
+		0xD0, 0x12, // DRW V0, V1, 2
+	}
+	sprite := []byte{0xF0, 0xF0}
+
+	tests := []struct {
+		name   string
+		quirks Quirks
+		// Pixels in the part of the sprite that runs off the right, the
+		// bottom, and the bottom right.
+		right, bottom, corner bool
+	}{
+		{"wrap", Quirks{}, true, true, true},
+		{"clip x", Quirks{ClipX: true}, false, true, false},
+		{"clip y", Quirks{ClipY: true}, true, false, false},
+		{"VIP", Quirks{VIPSpriteWrap: true}, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := NewCPU(&Options{Quirks: tt.quirks})
+			cpu.Graphics.Display = NullDisplay
+			cpu.LoadBytes(program)
+			copy(cpu.Memory[0x300:], sprite)
+
+			assert.NoError(t, cpu.RunN(4))
+			// The position wraps, so the visible part is always drawn.
+			assert.True(t, cpu.Graphics.GetPixel(62, 31))
+			assert.True(t, cpu.Graphics.GetPixel(63, 31))
+			assert.Equal(t, tt.right, cpu.Graphics.GetPixel(1, 31), "right")
+			assert.Equal(t, tt.bottom, cpu.Graphics.GetPixel(63, 0), "bottom")
+			assert.Equal(t, tt.corner, cpu.Graphics.GetPixel(1, 0), "corner")
+		})
+	}
+}
+
+func TestCPU_WaitKeyOnRelease(t *testing.T) {
+	for _, onRelease := range []bool{false, true} {
+		cpu := NewCPU(&Options{Quirks: Quirks{WaitKeyOnRelease: onRelease}})
+		// The keypad reports presses as they happen.
+		cpu.Keypad = KeypadFunc(func() (byte, error) {
+			for k, down := range cpu.KeyState() {
+				if down {
+					return byte(k), nil
+				}
+			}
+			return 0, errors.New("no key pressed")
+		})
+		cpu.LoadBytes([]byte{
+			0xF3, 0x0A, // LD V3, K
+		})
+
+		cpu.PressKey(0x7)
+		assert.NoError(t, cpu.RunN(1))
+		if !onRelease {
+			assert.Equal(t, uint16(0x202), cpu.ProgramCounter, "press")
+			assert.Equal(t, byte(0x7), cpu.V[3])
+			continue
+		}
+
+		// Waiting for the release.
+		assert.Equal(t, uint16(0x200), cpu.ProgramCounter, "release")
+		assert.NoError(t, cpu.RunN(3))
+		assert.Equal(t, uint16(0x200), cpu.ProgramCounter)
+		assert.Equal(t, byte(0), cpu.V[3])
+
+		cpu.ReleaseKey(0x7)
+		assert.NoError(t, cpu.RunN(1))
+		assert.Equal(t, uint16(0x202), cpu.ProgramCounter)
+		assert.Equal(t, byte(0x7), cpu.V[3])
+	}
+}
+
+func TestCPU_WaitKeyOnReleaseWithoutFeed(t *testing.T) {
+	// A Keypad that only reports presses can't tell when a key is
+	// released, so FX0A completes on the press.
+	cpu := NewCPU(&Options{Quirks: Quirks{WaitKeyOnRelease: true}})
+	cpu.Keypad = KeypadFunc(func() (byte, error) { return 0x4, nil })
+	cpu.LoadBytes([]byte{
+		0xF3, 0x0A, // LD V3, K
+	})
+
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, uint16(0x202), cpu.ProgramCounter)
+	assert.Equal(t, byte(0x4), cpu.V[3])
+}
+
+func TestCPU_WaitKeyOnReleaseScripted(t *testing.T) {
+	cpu := NewCPU(&Options{Quirks: Quirks{WaitKeyOnRelease: true}})
+	cpu.Keypad = NewScriptedKeypad(cpu, []ScriptedInput{
+		{Cycle: 1, Key: 0x6, Hold: 3},
+	})
+	cpu.LoadBytes([]byte{
+		0xF3, 0x0A, // LD V3, K
+	})
+
+	// 6 is held from cycle 1 and let go at cycle 4.
+	assert.NoError(t, cpu.RunN(4))
+	assert.Equal(t, uint16(0x200), cpu.ProgramCounter)
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, uint16(0x202), cpu.ProgramCounter)
+	assert.Equal(t, byte(0x6), cpu.V[3])
+}
@@ -0,0 +1,152 @@
+package chip8
+
+import "errors"
+
+// ErrNoHistory is returned by StepBack when there is no instruction to step
+// back over, because none has run since the CPU was created or reset, the
+// history is used up, or Options.RewindDepth is zero.
+var ErrNoHistory = errors.New("chip8: no history to step back to")
+
+// snapshot is the state of the CPU before an instruction, for StepBack.
+type snapshot struct {
+	v                      [16]byte
+	i, pc                  uint16
+	stack                  [16]uint16
+	sp                     byte
+	delayTimer, soundTimer byte
+	waiting                bool
+	waitKey                byte
+	audioBuffer            [16]byte
+	pitch                  byte
+	cycles, collisions     uint64
+	mega                   megaChip
+
+	// graphics is the screen. It is only copied when an instruction has
+	// changed it, so consecutive snapshots share it.
+	graphics *Graphics
+
+	// writes are the memory writes the instruction made, in order, with
+	// the bytes they overwrote. Memory is restored from them rather than
+	// copied whole.
+	writes []memoryWrite
+}
+
+type memoryWrite struct {
+	addr uint16
+	old  byte
+}
+
+// history is a ring buffer of the snapshots taken before the most recent
+// instructions, up to Options.RewindDepth of them.
+type history struct {
+	snapshots []snapshot
+
+	// next is where the next snapshot goes, and n how many are held.
+	next, n int
+
+	// screen is the copy of the screen in the latest snapshot, taken when
+	// Graphics.changes was changes. It is nil if the next snapshot needs a
+	// new copy.
+	screen  *Graphics
+	changes uint64
+}
+
+func newHistory(depth int) *history {
+	return &history{snapshots: make([]snapshot, depth)}
+}
+
+// push records the state of c before an instruction runs, overwriting the
+// oldest snapshot once the buffer is full.
+func (h *history) push(c *CPU) {
+	if h.screen == nil || c.Graphics.changes != h.changes {
+		h.screen = new(Graphics)
+		*h.screen = c.Graphics
+		h.changes = c.Graphics.changes
+	}
+	s := &h.snapshots[h.next]
+	*s = snapshot{
+		v:           c.V,
+		i:           c.I,
+		pc:          c.ProgramCounter,
+		stack:       c.Stack,
+		sp:          c.StackPointer,
+		delayTimer:  c.DelayTimer,
+		soundTimer:  c.SoundTimer,
+		waiting:     c.waiting,
+		waitKey:     c.waitKey,
+		audioBuffer: c.audioBuffer,
+		pitch:       c.pitch,
+		cycles:      c.cycles,
+		collisions:  c.collisions,
+		mega:        c.mega,
+		graphics:    h.screen,
+		writes:      s.writes[:0],
+	}
+	h.next = (h.next + 1) % len(h.snapshots)
+	h.n = min(h.n+1, len(h.snapshots))
+}
+
+// recordWrite notes that the instruction being run overwrote old at addr.
+func (h *history) recordWrite(addr uint16, old byte) {
+	if h.n == 0 {
+		return
+	}
+	s := &h.snapshots[(h.next+len(h.snapshots)-1)%len(h.snapshots)]
+	s.writes = append(s.writes, memoryWrite{addr, old})
+}
+
+// pop removes and returns the most recent snapshot.
+func (h *history) pop() *snapshot {
+	h.next = (h.next + len(h.snapshots) - 1) % len(h.snapshots)
+	h.n--
+	h.screen = nil
+	return &h.snapshots[h.next]
+}
+
+// StepBack undoes the last instruction, restoring the memory, registers,
+// stack, timers and screen to what they were before it ran, and redraws.
+// It can be called repeatedly to go back up to Options.RewindDepth
+// instructions, and returns ErrNoHistory when it can't go further back.
+//
+// Only memory written by the built-in instructions is restored; writes made
+// by handlers added with RegisterOpcode, or by loading, are not. The
+// history is cleared by Reset.
+func (c *CPU) StepBack() error {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	if c.history == nil || c.history.n == 0 {
+		return ErrNoHistory
+	}
+
+	s := c.history.pop()
+	for i := len(s.writes) - 1; i >= 0; i-- {
+		c.Memory[s.writes[i].addr] = s.writes[i].old
+	}
+	c.V = s.v
+	c.I = s.i
+	c.ProgramCounter = s.pc
+	c.Stack = s.stack
+	c.StackPointer = s.sp
+	c.DelayTimer = s.delayTimer
+	c.SoundTimer = s.soundTimer
+	c.waiting = s.waiting
+	c.waitKey = s.waitKey
+	c.audioBuffer = s.audioBuffer
+	c.pitch = s.pitch
+	c.cycles = s.cycles
+	c.collisions = s.collisions
+	c.mega = s.mega
+
+	// The display and scale belong to the front-end, not the state.
+	resized := c.Graphics.Width() != s.graphics.Width() || c.Graphics.Height() != s.graphics.Height()
+	display, scale := c.Graphics.Display, c.Graphics.Scale
+	c.Graphics = *s.graphics
+	c.Graphics.Display, c.Graphics.Scale = display, scale
+	if d, ok := c.Graphics.display().(ResolutionAware); ok && resized {
+		d.SetResolution(c.Graphics.Width(), c.Graphics.Height())
+	}
+
+	c.updateBuzzer()
+	c.draw()
+	return nil
+}
@@ -0,0 +1,91 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPU_StepBack(t *testing.T) {
+	cpu := NewCPU(&Options{RewindDepth: 4})
+	cpu.LoadBytes([]byte{
+		0x60, 0x07, // LD V0, 7
+		0xA3, 0x00, // LD I, 0x300
+		0xF0, 0x33, // LD B, V0
+		0xF0, 0x29, // LD F, V0
+		0xD1, 0x15, // DRW V1, V1, 5
+		0x23, 0x10, // CALL 0x310
+	})
+	assert.Equal(t, ErrNoHistory, cpu.StepBack())
+
+	assert.NoError(t, cpu.RunN(2))
+	before := cpu.State(true)
+
+	assert.NoError(t, cpu.RunN(4))
+	assert.Equal(t, []byte{0, 0, 7}, cpu.Memory[0x300:0x303])
+	assert.NotZero(t, cpu.Graphics.CountOnPixels())
+	assert.Equal(t, byte(1), cpu.StackPointer)
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, cpu.StepBack())
+	}
+	assert.Equal(t, before, cpu.State(true))
+	assert.Equal(t, []byte{0, 0, 0}, cpu.Memory[0x300:0x303])
+	assert.Zero(t, cpu.Graphics.CountOnPixels())
+
+	// The history only went 4 deep.
+	assert.Equal(t, ErrNoHistory, cpu.StepBack())
+
+	// Running again after stepping back picks up from there.
+	assert.NoError(t, cpu.RunN(3))
+	assert.Equal(t, []byte{0, 0, 7}, cpu.Memory[0x300:0x303])
+	assert.NoError(t, cpu.StepBack())
+	assert.Equal(t, uint16(0x208), cpu.ProgramCounter)
+	assert.Zero(t, cpu.Graphics.CountOnPixels())
+
+	cpu.Reset()
+	assert.Equal(t, ErrNoHistory, cpu.StepBack())
+}
+
+func TestCPU_StepBack_disabled(t *testing.T) {
+	cpu := NewCPU(nil)
+	cpu.LoadBytes([]byte{0x60, 0x07}) // LD V0, 7
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, ErrNoHistory, cpu.StepBack())
+	assert.Equal(t, byte(7), cpu.V[0])
+}
+
+func TestCPU_StepBackSharesScreens(t *testing.T) {
+	cpu := NewCPU(&Options{RewindDepth: 8})
+	cpu.LoadBytes([]byte{
+		0x60, 0x07, // LD V0, 7
+		0xF0, 0x29, // LD F, V0
+		0xD1, 0x15, // DRW V1, V1, 5
+		0x61, 0x08, // LD V1, 8
+		0xD1, 0x15, // DRW V1, V1, 5
+		0x62, 0x01, // LD V2, 1
+	})
+	assert.NoError(t, cpu.RunN(6))
+
+	// The screen is only copied again after the instructions that drew.
+	h := cpu.history
+	assert.Same(t, h.snapshots[0].graphics, h.snapshots[1].graphics)
+	assert.Same(t, h.snapshots[1].graphics, h.snapshots[2].graphics)
+	assert.NotSame(t, h.snapshots[2].graphics, h.snapshots[3].graphics)
+	assert.Same(t, h.snapshots[3].graphics, h.snapshots[4].graphics)
+	assert.NotSame(t, h.snapshots[4].graphics, h.snapshots[5].graphics)
+
+	after := cpu.Graphics.String()
+	assert.NoError(t, cpu.StepBack())
+	assert.Equal(t, after, cpu.Graphics.String())
+	assert.NoError(t, cpu.StepBack())
+	drawn := cpu.Graphics.CountOnPixels()
+	assert.NotZero(t, drawn)
+	assert.NotEqual(t, after, cpu.Graphics.String())
+
+	// Drawing again after stepping back is recorded too.
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, after, cpu.Graphics.String())
+	assert.NoError(t, cpu.StepBack())
+	assert.Equal(t, drawn, cpu.Graphics.CountOnPixels())
+}
@@ -0,0 +1,38 @@
+package chip8
+
+// SUPER-CHIP high resolution, switched to with 00FF.
+const (
+	HiResWidth  = 128 // Pixels
+	HiResHeight = 64  // Pixels
+)
+
+// registerSCHIP adds the SUPER-CHIP opcodes to the CPU.
+func (c *CPU) registerSCHIP() {
+	for _, op := range schipOpcodes {
+		c.RegisterOpcode(op.spec.Mask, op.spec.Pattern, op.fn)
+	}
+}
+
+// 00FE	Switches to the low resolution of 64x32 and clears the screen.
+func (c *CPU) opLOW(opcode uint16) error {
+	c.setResolution(GraphicsWidth, GraphicsHeight)
+	c.ProgramCounter += 2
+	c.draw()
+	return nil
+}
+
+// 00FF	Switches to the high resolution of 128x64 and clears the screen.
+func (c *CPU) opHIGH(opcode uint16) error {
+	c.setResolution(HiResWidth, HiResHeight)
+	c.ProgramCounter += 2
+	c.draw()
+	return nil
+}
+
+// FX30 Sets I to the location of the 8x10 sprite for the digit in VX.
+func (c *CPU) opLDHF(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	c.I = BigFontAddress + uint16(c.V[x]%10)*0x0A
+	c.ProgramCounter += 2
+	return nil
+}
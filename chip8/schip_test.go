@@ -0,0 +1,81 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// resolutionDisplay records the resolutions it is told about.
+type resolutionDisplay struct {
+	resolutions [][2]int
+}
+
+func (d *resolutionDisplay) Render(*Graphics) error {
+	return nil
+}
+
+func (d *resolutionDisplay) SetResolution(width, height int) {
+	d.resolutions = append(d.resolutions, [2]int{width, height})
+}
+
+func TestCPU_HighLowResolution(t *testing.T) {
+	d := &resolutionDisplay{}
+	cpu := NewCPU(&Options{Preset: PresetSCHIP})
+	cpu.Graphics.Display = d
+	cpu.LoadBytes([]byte{
+		0x00, 0xFF, // HIGH
+		0x60, 0x78, // LD V0, 120
+		0xD0, 0x05, // DRW V0, V0, 5
+		0x00, 0xFE, // LOW
+	})
+
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, HiResWidth, cpu.Graphics.Width())
+	assert.Equal(t, HiResHeight, cpu.Graphics.Height())
+	assert.Equal(t, [][2]int{{128, 64}}, d.resolutions)
+
+	// The whole high resolution screen can be drawn to.
+	assert.NoError(t, cpu.RunN(2))
+	assert.True(t, cpu.Graphics.GetPixel(120, 120-64))
+
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, GraphicsWidth, cpu.Graphics.Width())
+	assert.Equal(t, 0, cpu.Graphics.CountOnPixels())
+	assert.Equal(t, [][2]int{{128, 64}, {64, 32}}, d.resolutions)
+
+	// Reset goes back to the low resolution.
+	cpu.ExecuteOpcode(0x00FF)
+	cpu.Reset()
+	assert.Equal(t, GraphicsWidth, cpu.Graphics.Width())
+	assert.Equal(t, [][2]int{{128, 64}, {64, 32}, {128, 64}, {64, 32}}, d.resolutions)
+}
+
+func TestCPU_HighLowResolutionNeedsSCHIP(t *testing.T) {
+	cpu := NewCPU(nil)
+	for _, opcode := range []uint16{0x00FE, 0x00FF} {
+		assert.Equal(t, &UnknownOpcode{Opcode: opcode}, cpu.ExecuteOpcode(opcode))
+	}
+	assert.Equal(t, GraphicsWidth, cpu.Graphics.Width())
+
+	for _, opts := range []*Options{{Preset: PresetXOCHIP}, {MegaChip: true}} {
+		cpu := NewCPU(opts)
+		assert.NoError(t, cpu.ExecuteOpcode(0x00FF))
+		assert.Equal(t, HiResWidth, cpu.Graphics.Width())
+	}
+}
+
+func TestCPU_FX30(t *testing.T) {
+	cpu := NewCPU(&Options{Preset: PresetSCHIP})
+	cpu.LoadBytes([]byte{0xF0, 0x30}) // LD HF, V0
+	cpu.V[0] = 7
+	if _, err := cpu.emulateCycle(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint16(BigFontAddress+70), cpu.I)
+
+	// Plain CHIP-8 has no big font to point at.
+	cpu = NewCPU(nil)
+	assert.Equal(t, &UnknownOpcode{Opcode: 0xF030}, cpu.ExecuteOpcode(0xF030))
+	assert.Equal(t, uint16(0), cpu.I)
+}
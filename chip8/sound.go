@@ -0,0 +1,156 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync/atomic"
+)
+
+// Buzzer plays the CHIP-8's single tone. On is called when the sound timer
+// becomes non-zero and Off when it reaches zero again.
+type Buzzer interface {
+	On()
+	Off()
+}
+
+// BuzzerFuncs adapts a pair of functions to the Buzzer interface.
+type BuzzerFuncs struct {
+	OnFunc, OffFunc func()
+}
+
+func (b BuzzerFuncs) On() {
+	if b.OnFunc != nil {
+		b.OnFunc()
+	}
+}
+
+func (b BuzzerFuncs) Off() {
+	if b.OffFunc != nil {
+		b.OffFunc()
+	}
+}
+
+// NullBuzzer is a silent Buzzer.
+var NullBuzzer = BuzzerFuncs{}
+
+// BellBuzzer rings the terminal bell when the tone starts. A terminal can't
+// hold a tone, so Off does nothing.
+var BellBuzzer = BuzzerFuncs{
+	OnFunc: func() {
+		fmt.Fprint(os.Stdout, "\a")
+	},
+}
+
+// updateBuzzer turns the buzzer on or off to match the sound timer.
+func (c *CPU) updateBuzzer() {
+	switch on := c.SoundTimer > 0 && !c.paused; {
+	case on && !c.buzzing:
+		c.buzzing = true
+		c.buzzer().On()
+	case !on && c.buzzing:
+		c.buzzing = false
+		c.buzzer().Off()
+	}
+}
+
+func (c *CPU) buzzer() Buzzer {
+	if c.Buzzer == nil {
+		return DefaultBuzzer
+	}
+	return c.Buzzer
+}
+
+// Waveform is the shape of the tone a ToneBuzzer plays.
+type Waveform int
+
+// Waveforms a ToneBuzzer can play.
+const (
+	Square Waveform = iota
+	Sine
+	Triangle
+)
+
+// Sample returns the value of the waveform, between -1 and 1, at phase,
+// the position within a period between 0 and 1.
+func (w Waveform) Sample(phase float64) float64 {
+	switch w {
+	case Sine:
+		return math.Sin(2 * math.Pi * phase)
+	case Triangle:
+		switch {
+		case phase < 0.25:
+			return 4 * phase
+		case phase < 0.75:
+			return 2 - 4*phase
+		default:
+			return 4*phase - 4
+		}
+	default:
+		if phase < 0.5 {
+			return 1
+		}
+		return -1
+	}
+}
+
+// ToneBuzzer is a Buzzer for real audio backends. It generates the tone as
+// a stream of signed 16-bit little-endian mono samples, read with Read, and
+// silence while the buzzer is off.
+type ToneBuzzer struct {
+	// Frequency of the tone in Hz. Traditionally about 440.
+	Frequency float64
+
+	// Waveform of the tone. Traditionally a square wave.
+	Waveform Waveform
+
+	// Volume between 0 and 1.
+	Volume float64
+
+	// SampleRate of the stream in Hz.
+	SampleRate int
+
+	on    atomic.Bool
+	phase float64
+}
+
+// NewToneBuzzer returns a ToneBuzzer playing the traditional 440 Hz square
+// wave at sampleRate.
+func NewToneBuzzer(sampleRate int) *ToneBuzzer {
+	return &ToneBuzzer{
+		Frequency:  440,
+		Waveform:   Square,
+		Volume:     0.5,
+		SampleRate: sampleRate,
+	}
+}
+
+func (b *ToneBuzzer) On() {
+	b.on.Store(true)
+}
+
+func (b *ToneBuzzer) Off() {
+	b.on.Store(false)
+}
+
+// Read fills p with as many whole samples as fit. If p is too short for a
+// single sample, it returns io.ErrShortBuffer; otherwise it never fails.
+func (b *ToneBuzzer) Read(p []byte) (int, error) {
+	if len(p) < 2 {
+		return 0, io.ErrShortBuffer
+	}
+	n := len(p) / 2 * 2
+	on := b.on.Load()
+	for i := 0; i < n; i += 2 {
+		var v int16
+		if on {
+			v = int16(b.Waveform.Sample(b.phase) * b.Volume * math.MaxInt16)
+			b.phase += b.Frequency / float64(b.SampleRate)
+			b.phase -= math.Floor(b.phase)
+		}
+		binary.LittleEndian.PutUint16(p[i:], uint16(v))
+	}
+	return n, nil
+}
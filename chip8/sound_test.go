@@ -0,0 +1,139 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPU_Buzzer(t *testing.T) {
+	var events []string
+	cpu := NewCPU(nil)
+	cpu.Buzzer = BuzzerFuncs{
+		OnFunc:  func() { events = append(events, "on") },
+		OffFunc: func() { events = append(events, "off") },
+	}
+	cpu.LoadBytes([]byte{
+		0x60, 0x03, // LD V0, 0x03
+		0xF0, 0x18, // LD ST, V0
+	})
+
+	if err := cpu.RunN(2); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"on"}, events)
+
+	cpu.frame()
+	cpu.frame()
+	assert.Equal(t, []string{"on"}, events)
+
+	cpu.frame()
+	assert.Equal(t, byte(0), cpu.SoundTimer)
+	assert.Equal(t, []string{"on", "off"}, events)
+
+	cpu.frame()
+	assert.Equal(t, []string{"on", "off"}, events)
+}
+
+func TestWaveform_Sample(t *testing.T) {
+	tests := []struct {
+		waveform Waveform
+		phases   []float64
+		want     []float64
+	}{
+		{Square, []float64{0, 0.25, 0.5, 0.75}, []float64{1, 1, -1, -1}},
+		{Sine, []float64{0, 0.25, 0.5, 0.75}, []float64{0, 1, 0, -1}},
+		{Triangle, []float64{0, 0.125, 0.25, 0.5, 0.75, 0.875}, []float64{0, 0.5, 1, 0, -1, -0.5}},
+	}
+	for _, tt := range tests {
+		for i, phase := range tt.phases {
+			assert.InDelta(t, tt.want[i], tt.waveform.Sample(phase), 1e-9, "waveform %d phase %v", tt.waveform, phase)
+		}
+	}
+}
+
+func TestToneBuzzer_Read(t *testing.T) {
+	b := NewToneBuzzer(8)
+	b.Frequency = 2
+	b.Volume = 1
+	samples := func() []int16 {
+		p := make([]byte, 17)
+		n, err := b.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, 16, n)
+		s := make([]int16, n/2)
+		for i := range s {
+			s[i] = int16(binary.LittleEndian.Uint16(p[i*2:]))
+		}
+		return s
+	}
+
+	assert.Equal(t, make([]int16, 8), samples())
+
+	b.On()
+	hi, lo := int16(32767), int16(-32767)
+	assert.Equal(t, []int16{hi, hi, lo, lo, hi, hi, lo, lo}, samples())
+
+	b.Off()
+	assert.Equal(t, make([]int16, 8), samples())
+
+	// Without room for a sample it fails, rather than making an empty read
+	// that io.ReadFull would retry forever.
+	for _, p := range [][]byte{nil, make([]byte, 1)} {
+		n, err := b.Read(p)
+		assert.Equal(t, 0, n)
+		assert.ErrorIs(t, err, io.ErrShortBuffer)
+	}
+}
+
+func TestCPU_Pause(t *testing.T) {
+	var events []string
+	timing := &manualTiming{clock: make(chan time.Time), frame: make(chan time.Time)}
+	cpu := NewCPU(&Options{Timing: timing})
+	cpu.Buzzer = BuzzerFuncs{
+		OnFunc:  func() { events = append(events, "on") },
+		OffFunc: func() { events = append(events, "off") },
+	}
+	cpu.LoadBytes([]byte{
+		0x60, 0x0A, // LD V0, 0x0A
+		0xF0, 0x18, // LD ST, V0
+		0x12, 0x04, // JP 0x204
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- cpu.Run()
+	}()
+
+	timing.clock <- time.Time{}
+	timing.clock <- time.Time{}
+	timing.frame <- time.Time{}
+	timing.frame <- time.Time{}
+	timing.clock <- time.Time{} // waits for the frames to finish
+
+	cpu.Pause()
+	assert.True(t, cpu.Paused())
+	assert.Equal(t, byte(8), cpu.SoundTimer)
+	assert.Equal(t, []string{"on", "off"}, events)
+
+	for i := 0; i < 5; i++ {
+		timing.clock <- time.Time{}
+		timing.frame <- time.Time{}
+	}
+	timing.clock <- time.Time{}
+	assert.Equal(t, byte(8), cpu.SoundTimer)
+	assert.Equal(t, uint64(3), cpu.Cycles())
+
+	cpu.Resume()
+	assert.False(t, cpu.Paused())
+	assert.Equal(t, []string{"on", "off", "on"}, events)
+
+	timing.frame <- time.Time{}
+	timing.clock <- time.Time{}
+	cpu.Stop()
+	assert.NoError(t, <-done)
+	assert.Equal(t, byte(7), cpu.SoundTimer)
+}
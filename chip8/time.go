@@ -0,0 +1,58 @@
+package chip8
+
+import "time"
+
+// TimeSource provides the current time and tickers. Pass one to TimingFrom
+// to drive the CPU's clock and timers from it, so that a fake TimeSource
+// can drive emulation deterministically.
+type TimeSource interface {
+	Now() time.Time
+	Tick(d time.Duration) <-chan time.Time
+}
+
+// RealTime is the TimeSource backed by the time package.
+var RealTime TimeSource = realTime{}
+
+type realTime struct{}
+
+func (realTime) Now() time.Time {
+	return time.Now()
+}
+
+func (realTime) Tick(d time.Duration) <-chan time.Time {
+	return time.Tick(d)
+}
+
+// Timing supplies the time and the ticks that drive Run: Clock ticks once
+// per instruction, at hz instructions per second, and Frame once per frame,
+// at hz frames per second, to count the timers down and draw. Now is the
+// time keypads use to hold, debounce and repeat keys. What the ticks follow
+// is up to the implementation: real time, a fake clock in tests, or a
+// display's vsync.
+type Timing interface {
+	Now() time.Time
+	Clock(hz time.Duration) <-chan time.Time
+	Frame(hz time.Duration) <-chan time.Time
+}
+
+// TimingFrom returns a Timing that ticks at the given rates according to
+// ts.
+func TimingFrom(ts TimeSource) Timing {
+	return sourceTiming{ts}
+}
+
+type sourceTiming struct {
+	ts TimeSource
+}
+
+func (t sourceTiming) Now() time.Time {
+	return t.ts.Now()
+}
+
+func (t sourceTiming) Clock(hz time.Duration) <-chan time.Time {
+	return t.ts.Tick(time.Second / hz)
+}
+
+func (t sourceTiming) Frame(hz time.Duration) <-chan time.Time {
+	return t.ts.Tick(time.Second / hz)
+}
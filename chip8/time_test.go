@@ -0,0 +1,217 @@
+package chip8
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTime is a TimeSource whose tickers only fire when it is advanced.
+// Ticks are delivered synchronously, in time order.
+type fakeTime struct {
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+func newFakeTime() *fakeTime {
+	return &fakeTime{now: time.Unix(0, 0)}
+}
+
+func (f *fakeTime) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeTime) Tick(d time.Duration) <-chan time.Time {
+	t := &fakeTicker{
+		c:      make(chan time.Time),
+		period: d,
+		next:   f.now.Add(d),
+	}
+	f.tickers = append(f.tickers, t)
+	return t.c
+}
+
+// Advance moves the time forward by d, firing every tick that falls due.
+func (f *fakeTime) Advance(d time.Duration) {
+	end := f.now.Add(d)
+	for {
+		due := make([]*fakeTicker, 0, len(f.tickers))
+		for _, t := range f.tickers {
+			if !t.next.After(end) {
+				due = append(due, t)
+			}
+		}
+		if len(due) == 0 {
+			break
+		}
+		sort.SliceStable(due, func(i, j int) bool {
+			return due[i].next.Before(due[j].next)
+		})
+
+		t := due[0]
+		f.now = t.next
+		t.next = t.next.Add(t.period)
+		t.c <- f.now
+	}
+	f.now = end
+}
+
+func TestCPU_TimeSource(t *testing.T) {
+	ft := newFakeTime()
+	cpu := NewCPU(&Options{Timing: TimingFrom(ft)})
+	cpu.LoadBytes([]byte{0x12, 0x00}) // JP 0x200
+	cpu.DelayTimer = 100
+
+	done := make(chan error)
+	go func() {
+		done <- cpu.Run()
+	}()
+
+	ft.Advance(time.Second)
+	cpu.Stop()
+	assert.NoError(t, <-done)
+	assert.Equal(t, byte(40), cpu.DelayTimer)
+}
+
+func TestPacer(t *testing.T) {
+	p := pacer{rate: 500, fps: 60}
+	var frames []int
+	total := 0
+	for i := 0; i < 60; i++ {
+		n := p.next()
+		frames = append(frames, n)
+		total += n
+	}
+	assert.Equal(t, 500, total)
+	// 500/60 is 8 1/3, so every third frame runs an extra instruction.
+	assert.Equal(t, []int{8, 8, 9, 8, 8, 9}, frames[:6])
+}
+
+func TestCPU_TargetFPS(t *testing.T) {
+	ft := newFakeTime()
+	cpu := NewCPU(&Options{
+		Timing:     TimingFrom(ft),
+		ClockSpeed: 500,
+		TargetFPS:  30,
+	})
+	cpu.LoadBytes([]byte{0x12, 0x00}) // JP 0x200
+	cpu.DelayTimer = 100
+	assert.Nil(t, cpu.Clock)
+
+	done := make(chan error)
+	go func() {
+		done <- cpu.Run()
+	}()
+
+	ft.Advance(time.Second)
+	cpu.Stop()
+	assert.NoError(t, <-done)
+	assert.Equal(t, uint64(500), cpu.Cycles())
+	assert.Equal(t, byte(40), cpu.DelayTimer)
+}
+
+func TestCPU_SetSpeedMultiplier(t *testing.T) {
+	for _, targetFPS := range []int{0, 30} {
+		ft := newFakeTime()
+		cpu := NewCPU(&Options{
+			Timing:     TimingFrom(ft),
+			ClockSpeed: 500,
+			TargetFPS:  targetFPS,
+		})
+		cpu.LoadBytes([]byte{0x12, 0x00}) // JP 0x200
+		cpu.DelayTimer = 200
+		cpu.SetSpeedMultiplier(2)
+
+		done := make(chan error)
+		go func() {
+			done <- cpu.Run()
+		}()
+
+		ft.Advance(time.Second)
+		cpu.Stop()
+		assert.NoError(t, <-done)
+		assert.Equal(t, uint64(1000), cpu.Cycles(), "TargetFPS %d", targetFPS)
+		// The timers aren't sped up.
+		assert.Equal(t, byte(140), cpu.DelayTimer, "TargetFPS %d", targetFPS)
+	}
+}
+
+func TestCPU_SetSpeedMultiplier_RunFrame(t *testing.T) {
+	cpu := NewCPU(&Options{ClockSpeed: 600})
+	cpu.LoadBytes([]byte{0x12, 0x00}) // JP 0x200
+
+	assert.NoError(t, cpu.RunFrame())
+	assert.Equal(t, uint64(10), cpu.Cycles())
+
+	cpu.SetSpeedMultiplier(2)
+	assert.NoError(t, cpu.RunFrame())
+	assert.Equal(t, uint64(30), cpu.Cycles())
+
+	cpu.SetSpeedMultiplier(0.5)
+	assert.NoError(t, cpu.RunFrame())
+	assert.Equal(t, uint64(35), cpu.Cycles())
+
+	cpu.SetSpeedMultiplier(0)
+	assert.NoError(t, cpu.RunFrame())
+	assert.Equal(t, uint64(45), cpu.Cycles())
+}
+
+// manualTiming is a Timing whose ticks are sent by hand.
+type manualTiming struct {
+	clock, frame     chan time.Time
+	clockHz, frameHz time.Duration
+}
+
+func (m *manualTiming) Now() time.Time {
+	return time.Time{}
+}
+
+func (m *manualTiming) Clock(hz time.Duration) <-chan time.Time {
+	m.clockHz = hz
+	return m.clock
+}
+
+func (m *manualTiming) Frame(hz time.Duration) <-chan time.Time {
+	m.frameHz = hz
+	return m.frame
+}
+
+func TestCPU_Timing(t *testing.T) {
+	timing := &manualTiming{clock: make(chan time.Time), frame: make(chan time.Time)}
+	cpu := NewCPU(&Options{Timing: timing, ClockSpeed: 500})
+	assert.Equal(t, time.Duration(500), timing.clockHz)
+	assert.Equal(t, FrameRate, timing.frameHz)
+	cpu.LoadBytes([]byte{
+		0x70, 0x01, // ADD V0, 1
+		0x12, 0x00, // JP 0x200
+	})
+	cpu.DelayTimer = 10
+
+	done := make(chan error)
+	go func() {
+		done <- cpu.Run()
+	}()
+
+	for i := 0; i < 7; i++ {
+		timing.clock <- time.Time{}
+	}
+	for i := 0; i < 3; i++ {
+		timing.frame <- time.Time{}
+	}
+	// Sending another tick waits for the last one to be handled.
+	timing.clock <- time.Time{}
+	cpu.Stop()
+	assert.NoError(t, <-done)
+
+	assert.Equal(t, uint64(8), cpu.Cycles())
+	assert.Equal(t, byte(4), cpu.V[0])
+	assert.Equal(t, byte(7), cpu.DelayTimer)
+}
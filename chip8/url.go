@@ -0,0 +1,51 @@
+package chip8
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// LoadURLTimeout bounds how long LoadURL waits for a ROM.
+var LoadURLTimeout = 30 * time.Second
+
+// LoadURL fetches a ROM over HTTP or HTTPS and loads it, giving up after
+// LoadURLTimeout.
+func (c *CPU) LoadURL(url string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), LoadURLTimeout)
+	defer cancel()
+	return c.LoadURLContext(ctx, url)
+}
+
+// LoadURLContext is like LoadURL, but is bounded by ctx instead. ROMs that
+// don't fit in memory are rejected without being loaded.
+func (c *CPU) LoadURLContext(ctx context.Context, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("chip8: fetching %s: %s", url, resp.Status)
+	}
+
+	limit := int64(len(c.Memory) - 0x200)
+	if resp.ContentLength > limit {
+		return 0, fmt.Errorf("chip8: ROM at %s is %d bytes, at most %d fit in memory", url, resp.ContentLength, limit)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(b)) > limit {
+		return 0, fmt.Errorf("chip8: ROM at %s is larger than the %d bytes that fit in memory", url, limit)
+	}
+	return c.Load(bytes.NewReader(b))
+}
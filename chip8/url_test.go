@@ -0,0 +1,46 @@
+package chip8
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPU_LoadURL(t *testing.T) {
+	program := []byte{0x60, 0x05, 0x12, 0x00}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rom.ch8", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(program)
+	})
+	mux.HandleFunc("/big.ch8", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, DefaultMemorySize))
+	})
+	mux.HandleFunc("/slow.ch8", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cpu := NewCPU(nil)
+	n, err := cpu.LoadURL(srv.URL + "/rom.ch8")
+	assert.NoError(t, err)
+	assert.Equal(t, len(program), n)
+	assert.Equal(t, program, cpu.Memory[0x200:0x204])
+
+	_, err = cpu.LoadURL(srv.URL + "/missing.ch8")
+	assert.EqualError(t, err, "chip8: fetching "+srv.URL+"/missing.ch8: 404 Not Found")
+
+	cpu = NewCPU(nil)
+	_, err = cpu.LoadURL(srv.URL + "/big.ch8")
+	assert.Error(t, err)
+	assert.Equal(t, make([]byte, 4), cpu.Memory[0x200:0x204])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = cpu.LoadURLContext(ctx, srv.URL+"/slow.ch8")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
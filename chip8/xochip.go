@@ -0,0 +1,87 @@
+package chip8
+
+import "math"
+
+// DefaultPitch is the XO-CHIP audio pitch before FX3A sets it, which plays
+// the audio pattern at 4000 bits per second.
+const DefaultPitch = 64
+
+// AudioBuffer returns the XO-CHIP audio pattern: 128 bits, played most
+// significant bit first while the sound timer is non-zero. Playback itself
+// is left to the Buzzer.
+func (c *CPU) AudioBuffer() [16]byte {
+	return c.audioBuffer
+}
+
+// Pitch returns the XO-CHIP audio pitch.
+func (c *CPU) Pitch() byte {
+	return c.pitch
+}
+
+// PlaybackRate returns the rate, in bits per second, at which the audio
+// pattern is played at the current pitch.
+func (c *CPU) PlaybackRate() float64 {
+	return 4000 * math.Exp2((float64(c.pitch)-64)/48)
+}
+
+// registerXOCHIP adds the XO-CHIP opcodes to the CPU.
+func (c *CPU) registerXOCHIP() {
+	for _, op := range xochipOpcodes {
+		c.RegisterOpcode(op.spec.Mask, op.spec.Pattern, op.fn)
+	}
+}
+
+// FN01	Selects the planes drawn to, bit 0 of N for the first plane and bit 1
+// for the second.
+func (c *CPU) opPLANE(opcode uint16) error {
+	c.Graphics.SetPlanes(byte((opcode & 0x0F00) >> 8))
+	c.ProgramCounter += 2
+	return nil
+}
+
+// spritePlanes returns the number of planes in planes a sprite is drawn to
+// one after the other, and so how many n byte sprites DXYN reads. With a
+// single plane, or none, that is one.
+func spritePlanes(planes byte) int {
+	if planes == 0x03 {
+		return 2
+	}
+	return 1
+}
+
+// drawPlanes draws the n byte sprite at the start of sprite to the selected
+// planes. When both planes are selected, XO-CHIP draws a sprite to each in
+// turn, the first n bytes to the first plane and the next n to the second.
+// It reports whether there was a collision in any plane.
+func (c *CPU) drawPlanes(planes byte, sprite []byte, n uint16, x, y byte, clipX, clipY bool) (collision bool) {
+	if spritePlanes(planes) == 1 {
+		return c.Graphics.WriteSpriteClipped(sprite[:n], x, y, clipX, clipY)
+	}
+
+	defer c.Graphics.SetPlanes(planes)
+	for i := uint(0); i < 2; i++ {
+		c.Graphics.SetPlanes(1 << i)
+		if c.Graphics.WriteSpriteClipped(sprite[uint(n)*i:uint(n)*(i+1)], x, y, clipX, clipY) {
+			collision = true
+		}
+	}
+	return
+}
+
+// F002	Loads the 16 byte audio pattern at I into the audio buffer.
+func (c *CPU) opAUDIO(opcode uint16) error {
+	if err := c.checkAddress(c.I, len(c.audioBuffer)); err != nil {
+		return err
+	}
+	copy(c.audioBuffer[:], c.Memory[c.I:])
+	c.ProgramCounter += 2
+	return nil
+}
+
+// FX3A	Sets the audio playback pitch to VX.
+func (c *CPU) opPITCH(opcode uint16) error {
+	x := (opcode & 0x0F00) >> 8
+	c.pitch = c.V[x]
+	c.ProgramCounter += 2
+	return nil
+}
@@ -0,0 +1,92 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPU_F002(t *testing.T) {
+	cpu := NewCPU(&Options{Preset: PresetXOCHIP})
+	pattern := []byte{
+		0xFF, 0x00, 0xFF, 0x00, 0xF0, 0xF0, 0xF0, 0xF0,
+		0xAA, 0x55, 0xAA, 0x55, 0x01, 0x02, 0x03, 0x04,
+	}
+	cpu.LoadBytes([]byte{
+		0xA3, 0x00, // LD I, 0x300
+		0xF0, 0x02, // AUDIO
+	})
+	copy(cpu.Memory[0x300:], pattern)
+
+	assert.NoError(t, cpu.RunN(2))
+	buf := cpu.AudioBuffer()
+	assert.Equal(t, pattern, buf[:])
+	assert.Equal(t, uint16(0x204), cpu.ProgramCounter)
+
+	cpu.I = uint16(len(cpu.Memory) - 8)
+	assert.Equal(t, &AddressError{Address: len(cpu.Memory) + 7}, cpu.ExecuteOpcode(0xF002))
+}
+
+func TestCPU_FX3A(t *testing.T) {
+	cpu := NewCPU(&Options{Preset: PresetXOCHIP})
+	assert.Equal(t, byte(DefaultPitch), cpu.Pitch())
+	assert.InDelta(t, 4000, cpu.PlaybackRate(), 1e-9)
+
+	cpu.LoadBytes([]byte{
+		0x65, 0x70, // LD V5, 112
+		0xF5, 0x3A, // PITCH V5
+	})
+	assert.NoError(t, cpu.RunN(2))
+	assert.Equal(t, byte(112), cpu.Pitch())
+	// 48 steps up is an octave.
+	assert.InDelta(t, 8000, cpu.PlaybackRate(), 1e-9)
+}
+
+func TestCPU_FN01(t *testing.T) {
+	cpu := NewCPU(&Options{Preset: PresetXOCHIP})
+	cpu.LoadBytes([]byte{
+		0xF2, 0x01, // PLANE 2
+		0xA3, 0x00, // LD I, 0x300
+		0xD0, 0x01, // DRW V0, V0, 1
+		0xF3, 0x01, // PLANE 3
+		0xA3, 0x02, // LD I, 0x302
+		0xD0, 0x01, // DRW V0, V0, 1
+		0xD0, 0x01, // DRW V0, V0, 1
+	})
+	cpu.Memory[0x300] = 0x80
+	// With both planes selected, a sprite is read for each in turn.
+	copy(cpu.Memory[0x302:], []byte{0x40, 0x80})
+
+	assert.NoError(t, cpu.RunN(3))
+	assert.Equal(t, byte(0x02), cpu.Graphics.Planes())
+	assert.Equal(t, byte(0), cpu.V[0xF])
+	assert.True(t, cpu.Graphics.GetPlanePixel(1, 0, 0))
+	assert.False(t, cpu.Graphics.GetPixel(0, 0))
+
+	// Only the second plane collides.
+	assert.NoError(t, cpu.RunN(3))
+	assert.Equal(t, byte(0x03), cpu.Graphics.Planes())
+	assert.Equal(t, byte(1), cpu.V[0xF])
+	assert.False(t, cpu.Graphics.GetPlanePixel(1, 0, 0))
+	assert.True(t, cpu.Graphics.GetPlanePixel(0, 1, 0))
+
+	// Only the first plane collides.
+	assert.NoError(t, cpu.RunN(1))
+	assert.Equal(t, byte(1), cpu.V[0xF])
+	assert.False(t, cpu.Graphics.GetPlanePixel(0, 1, 0))
+	assert.True(t, cpu.Graphics.GetPlanePixel(1, 0, 0))
+
+	cpu.Reset()
+	assert.Equal(t, byte(0x01), cpu.Graphics.Planes())
+}
+
+func TestCPU_XOCHIPOpcodesNeedPreset(t *testing.T) {
+	for _, preset := range []Preset{PresetNone, PresetSCHIP} {
+		cpu := NewCPU(&Options{Preset: preset})
+		for _, opcode := range []uint16{0xF201, 0xF002, 0xF53A} {
+			assert.Equal(t, &UnknownOpcode{Opcode: opcode}, cpu.ExecuteOpcode(opcode))
+		}
+		assert.Equal(t, byte(0x01), cpu.Graphics.Planes())
+		assert.Equal(t, byte(DefaultPitch), cpu.Pitch())
+	}
+}
@@ -1,43 +1,122 @@
 package main
 
 import (
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/nsf/termbox-go"
 	"github.com/scottjab/go-chip8/chip8"
+	"github.com/scottjab/go-chip8/chip8/monitor"
 	"io/ioutil"
 )
 
+var (
+	keyMapPath  = flag.String("keymap", "", "path to a JSON file mapping keyboard keys to CHIP-8 keys")
+	monitorMode = flag.Bool("monitor", false, "start an interactive monitor instead of running the ROM")
+	arrowKeys   = flag.Bool("arrows", false, "also play with the arrow keys and space")
+	demo        = flag.String("demo", "", "run a built-in demo ROM instead of a file: "+strings.Join(chip8.DemoNames(), ", "))
+	platform    = flag.String("platform", "", "platform to run the ROM as, instead of detecting it: "+strings.Join(chip8.PresetNames(), ", "))
+)
+
 func main() {
-	d, err := chip8.NewTermboxDisplay(
-		termbox.ColorDefault,
-		termbox.ColorDefault,
-	)
-	defer d.Close()
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] ./path/to/chip8/rom\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] -demo name\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if (*demo == "") != (flag.NArg() == 1) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	var program []byte
+	var err error
+	romName := flag.Arg(0)
+	if *demo != "" {
+		romName = *demo
+		logger.Info("loading demo rom", "name", *demo)
+		program, err = chip8.DemoROM(*demo)
+	} else {
+		logger.Info("loading rom", "path", flag.Arg(0))
+		program, err = ioutil.ReadFile(flag.Arg(0))
+	}
 	if err != nil {
 		panic(err)
 	}
-	k := chip8.NewTermboxKeypad()
+
+	preset, profile, err := choosePreset(*platform, program, chip8.DefaultQuirkDB)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	cpu := chip8.NewCPU(&chip8.Options{
-		ClockSpeed: 60,
+		Preset: preset,
+		Logger: logger,
 	})
-	cpu.Graphics.Display = d
-	cpu.Keypad = k
-
-	log.Println("Loading rom")
-	program, err := ioutil.ReadFile(os.Args[1])
+	if profile {
+		cpu.ApplyProfile(chip8.ROMHash(program))
+	}
+	_, err = cpu.LoadBytes(program)
 	if err != nil {
 		panic(err)
 	}
 
-	_, err = cpu.LoadBytes(program)
+	if *monitorMode {
+		if err := monitor.New(cpu, os.Stdout).Run(os.Stdin); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	k := chip8.NewTermboxKeypad()
+	if *keyMapPath != "" {
+		f, err := os.Open(*keyMapPath)
+		if err != nil {
+			panic(err)
+		}
+		m, err := chip8.KeyMapFromReader(f)
+		f.Close()
+		if err != nil {
+			panic(err)
+		}
+		k = chip8.NewTermboxKeypadWithMap(m)
+	}
+	if *arrowKeys {
+		k.SpecialKeyMap = chip8.ArrowKeyMap
+	}
+	k.Hotkeys = map[termbox.Key]func(){
+		termbox.KeyF12: func() {
+			name := snapshotName(romName, time.Now())
+			if err := saveSnapshot(&cpu.Graphics, name); err != nil {
+				logger.Error("saving screenshot", "error", err)
+				return
+			}
+			logger.Info("saved screenshot", "path", name)
+		},
+	}
+
+	d, err := chip8.NewTermboxDisplay(
+		termbox.ColorDefault,
+		termbox.ColorDefault,
+	)
+	defer d.Close()
 	if err != nil {
 		panic(err)
 	}
-	sig := make(chan os.Signal)
+	cpu.Graphics.Display = d
+	cpu.Keypad = k
+
+	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-sig
@@ -49,3 +128,36 @@ func main() {
 		panic(err)
 	}
 }
+
+// choosePreset returns the preset to run program with. The -platform flag,
+// if set, wins. Otherwise ROMs get the preset DetectPlatform guesses, so
+// SUPER-CHIP ROMs get the SUPER-CHIP opcodes and quirks. A ROM in db has its
+// quirk profile applied over the preset's, and profile is true.
+func choosePreset(platform string, program []byte, db *chip8.QuirkDB) (preset chip8.Preset, profile bool, err error) {
+	if platform != "" {
+		preset, err = chip8.ParsePreset(platform)
+		return preset, false, err
+	}
+	_, ok := db.Lookup(chip8.ROMHash(program))
+	return chip8.DetectPlatform(program), ok, nil
+}
+
+// snapshotName returns the file name for a screenshot of rom taken at t,
+// e.g. pong-20240102-150405.000.png.
+func snapshotName(rom string, t time.Time) string {
+	base := strings.TrimSuffix(filepath.Base(rom), filepath.Ext(rom))
+	return fmt.Sprintf("%s-%s.png", base, t.Format("20060102-150405.000"))
+}
+
+// saveSnapshot writes a screenshot of g to the file name.
+func saveSnapshot(g *chip8.Graphics, name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := g.SnapshotPNG(f, 8); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
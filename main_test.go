@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scottjab/go-chip8/chip8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotName(t *testing.T) {
+	at := time.Date(2024, 1, 2, 15, 4, 5, 678e6, time.UTC)
+	assert.Equal(t, "pong-20240102-150405.678.png", snapshotName("roms/pong.ch8", at))
+	assert.Equal(t, "bounce-20240102-150405.678.png", snapshotName("bounce", at))
+}
+
+func TestChoosePreset(t *testing.T) {
+	schip := []byte{0x00, 0xFF} // HIGH
+	db := chip8.NewQuirkDB()
+
+	p, profile, err := choosePreset("", schip, db)
+	assert.NoError(t, err)
+	assert.Equal(t, chip8.PresetSCHIP, p)
+	assert.False(t, profile)
+
+	// The flag wins over detection.
+	p, _, err = choosePreset("chip8", schip, db)
+	assert.NoError(t, err)
+	assert.Equal(t, chip8.PresetNone, p)
+
+	// A ROM in the database gets its profile too, but keeps the
+	// platform's opcodes.
+	db.Register(chip8.ROMHash(schip), chip8.Quirks{ShiftUsesVY: true})
+	p, profile, err = choosePreset("", schip, db)
+	assert.NoError(t, err)
+	assert.Equal(t, chip8.PresetSCHIP, p)
+	assert.True(t, profile)
+
+	_, _, err = choosePreset("gameboy", schip, db)
+	assert.Error(t, err)
+}